@@ -24,13 +24,22 @@ import (
 var (
 	countrycode, mobile, password string
 
+	// passwordProvider credential provider spec to save in the device registration
+	passwordProvider string
+
 	accountCmd = &cobra.Command{
 		Use:   "account",
 		Short: "Authy account info or register device",
 		Long: `Register device or show registered account info. 
 
 Can specify country code, mobile number and authy main password.
-If not provided, will get from command line stdin`,
+If not provided, will get from command line stdin
+
+--password-provider selects where the authy backup password comes from:
+  prompt        ask every time, never saved
+  env[:NAME]    environment variable, AUTHY_PASSWORD by default
+  cmd:COMMAND   first line of the output of a command, e.g. cmd:pass show authy
+  file          file encrypted with your passphrase (default)`,
 		Run: func(cmd *cobra.Command, args []string) {
 			registerOrGetDeviceInfo()
 		},
@@ -43,14 +52,20 @@ func init() {
 	accountCmd.Flags().StringVarP(&countrycode, "countrycode", "c", "", "phone number country code (e.g. 1 for United States), digitals only")
 	accountCmd.Flags().StringVarP(&mobile, "mobilenumber", "m", "", "phone number, digitals only")
 	accountCmd.Flags().StringVarP(&password, "password", "p", "", "authy main password")
+	accountCmd.Flags().StringVar(&passwordProvider, "password-provider", "", "backup password provider: prompt, env[:NAME], cmd:COMMAND or file")
 }
 
 func registerOrGetDeviceInfo() {
-	_, tokens, err := Initialize()
+	devInfo, tokens, err := Initialize()
 	if err != nil {
 		return
 	}
 
+	provider, err := devInfo.credentialProvider()
+	if err == nil {
+		fmt.Printf("\nBackup password provider: %s\n", provider)
+	}
+
 	fmt.Printf("\nLoaded %d auth tokens from authy server\n\n", len(tokens))
 	for _, v := range tokens {
 		fmt.Printf("Token: %s\n", v.Name)
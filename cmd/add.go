@@ -0,0 +1,251 @@
+//
+// Copyright © 2020 alexj@backpocket.com
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/alexj212/authy/totp"
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+)
+
+// addCmd represents the add command
+var addCmd = &cobra.Command{
+	Use:   "add [TokenName]",
+	Short: "add a token that is not in authy to the local token store",
+	Long: `add a token that is not in authy to the local token store
+
+Give the base32 secret with --secret, or an otpauth:// uri with --uri. With --uri the token name
+defaults to the label of the uri, Issuer:Account, or the account name when the uri has no issuer.
+Local tokens are listed next to the tokens synced from authy, they survive refresh and can only be
+deleted with remove.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		if len(args) > 1 {
+			cmd.Help()
+			return
+		}
+
+		uri, err := cmd.Flags().GetString("uri")
+		if err != nil {
+			cmd.Help()
+			return
+		}
+
+		if uri == "" && len(args) == 0 {
+			cmd.Help()
+			return
+		}
+
+		var tk *Token
+		if uri != "" {
+			tk, err = ParseTokenURI(uri)
+			if err != nil {
+				fmt.Printf("Error unable to parse otpauth uri: %v\n", err)
+				return
+			}
+		} else {
+			tk, err = addTokenFromFlags(cmd)
+			if err != nil {
+				fmt.Printf("Error %v\n", err)
+				cmd.Help()
+				return
+			}
+		}
+
+		if len(args) == 1 {
+			tk.Name = args[0]
+		}
+
+		addCmdRun(tk)
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(addCmd)
+	addCmd.Flags().StringP("secret", "s", "", "base32 encoded secret")
+	addCmd.Flags().String("uri", "", "otpauth uri of the token instead of --secret")
+	addCmd.Flags().IntP("digits", "d", totp.DefaultCodeLength, "number of digits in a code")
+	addCmd.Flags().IntP("period", "p", totp.Interval, "seconds each code is valid for")
+	addCmd.Flags().StringP("algorithm", "a", totp.AlgorithmSHA1.String(), "hmac algorithm, SHA1, SHA256 or SHA512")
+	addCmd.Flags().StringP("type", "t", TokenTypeTotp, "token type, totp, hotp, steam or ocra")
+	addCmd.Flags().String("suite", "", "ocra suite of ocra tokens, e.g. OCRA-1:HOTP-SHA1-6:QN08")
+	addCmd.Flags().Uint64("counter", 0, "initial counter of hotp tokens")
+	addCmd.Flags().String("issuer", "", "issuer of the token")
+}
+
+// addTokenFromFlags create token from the add command flags
+func addTokenFromFlags(cmd *cobra.Command) (*Token, error) {
+	secret, err := cmd.Flags().GetString("secret")
+	if err != nil {
+		return nil, err
+	}
+
+	if secret == "" {
+		return nil, errors.New("either --secret or --uri is required")
+	}
+
+	digits, err := cmd.Flags().GetInt("digits")
+	if err != nil {
+		return nil, err
+	}
+
+	period, err := cmd.Flags().GetInt("period")
+	if err != nil {
+		return nil, err
+	}
+
+	algorithm, err := cmd.Flags().GetString("algorithm")
+	if err != nil {
+		return nil, err
+	}
+
+	tokenType, err := cmd.Flags().GetString("type")
+	if err != nil {
+		return nil, err
+	}
+
+	counter, err := cmd.Flags().GetUint64("counter")
+	if err != nil {
+		return nil, err
+	}
+
+	issuer, err := cmd.Flags().GetString("issuer")
+	if err != nil {
+		return nil, err
+	}
+
+	suite, err := cmd.Flags().GetString("suite")
+	if err != nil {
+		return nil, err
+	}
+
+	tk := &Token{
+		Secret:  secret,
+		Digital: digits,
+		Period:  period,
+		Counter: counter,
+		Issuer:  issuer,
+	}
+
+	switch strings.ToLower(tokenType) {
+	case TokenTypeTotp:
+	case TokenTypeHotp:
+		tk.Type = TokenTypeHotp
+	case TokenTypeSteam:
+		tk.Type = TokenTypeSteam
+		if !cmd.Flags().Changed("digits") {
+			tk.Digital = totp.SteamCodeLength
+		}
+	case TokenTypeOcra:
+		if suite == "" {
+			return nil, errors.New("ocra tokens require --suite")
+		}
+
+		ocraSuite, err := totp.ParseOCRASuite(suite)
+		if err != nil {
+			return nil, err
+		}
+
+		tk.Type = TokenTypeOcra
+		tk.Suite = ocraSuite.Suite
+		tk.Digital = ocraSuite.Digits
+		algorithm = ocraSuite.Algorithm.String()
+	default:
+		return nil, errors.Errorf("unsupported token type: %s", tokenType)
+	}
+
+	if suite != "" && tk.Type != TokenTypeOcra {
+		return nil, errors.New("--suite is only used by ocra tokens")
+	}
+
+	alg, err := totp.ParseAlgorithm(algorithm)
+	if err != nil {
+		return nil, err
+	}
+
+	if alg != totp.AlgorithmSHA1 {
+		tk.Algorithm = alg.String()
+	}
+	return tk, nil
+}
+
+// checkToken normalize the token secret and return an error if no code can be generated for the token
+func checkToken(tk *Token) error {
+	if tk.Name == "" {
+		return errors.New("token has no name")
+	}
+
+	if tk.Period < 0 {
+		return errors.Errorf("invalid period: %d", tk.Period)
+	}
+
+	dec := totp.DefaultNewBase32Decode()
+	key, err := dec.Decode(tk.Secret)
+	if err != nil {
+		return errors.Wrap(err, "invalid secret")
+	}
+
+	if len(key) == 0 {
+		return errors.New("empty secret")
+	}
+	tk.Secret = dec.Encode(key)
+
+	if tk.IsOcra() {
+		_, err = totp.ParseOCRASuite(tk.Suite)
+		return err
+	}
+
+	_, err = tk.GetTotpCodeForStep(0)
+	return err
+}
+
+func addCmdRun(tk *Token) {
+	err := checkToken(tk)
+	if err != nil {
+		fmt.Printf("Error %v\n", err)
+		return
+	}
+
+	tokens, err := cachedTokens()
+	if err != nil {
+		fmt.Printf("Error unable to load token cache: %v\n", err)
+		return
+	}
+
+	local, err := loadLocalTokens()
+	if err != nil {
+		fmt.Printf("Error unable to load local tokens: %v\n", err)
+		return
+	}
+
+	tokens = append(tokens, local...)
+	if _, err := findToken(tokens, tk.Name); err == nil {
+		fmt.Printf("Error token: %s already exists\n", tk.Name)
+		return
+	}
+
+	added, err := addLocalTokens(tokens, []*Token{tk})
+	if err != nil {
+		fmt.Printf("Error unable to save local tokens: %v\n", err)
+		return
+	}
+
+	for _, v := range added {
+		fmt.Printf("Added local token: %s\n", v.Name)
+	}
+}
@@ -0,0 +1,114 @@
+//
+// Copyright © 2020 alexj@backpocket.com
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+)
+
+// backupSuffix appended to a file name for the copy of its previous version
+const backupSuffix = ".bak"
+
+// writeFileAtomic replace the contents of fpath with data. The data is written to a temp file in the same
+// directory, synced and renamed over fpath, so readers see either the old or the new file and never a partial
+// one. The directory of fpath is created if it does not exist. The previous version is kept as fpath.bak,
+// unless it is plaintext and data is encrypted, a previous version less protected than the new one is never kept.
+func writeFileAtomic(fpath string, data []byte, perm os.FileMode) error {
+	keepBackup := true
+	if isSealed(data) {
+		prev, err := ioutil.ReadFile(fpath)
+		keepBackup = err != nil || isSealed(prev)
+	}
+	return replaceFile(fpath, data, perm, keepBackup)
+}
+
+// replaceFile atomically replace the contents of fpath with data, see writeFileAtomic. Without keepBackup
+// fpath.bak is removed rather than replaced with the previous version.
+func replaceFile(fpath string, data []byte, perm os.FileMode, keepBackup bool) error {
+	dir, name := filepath.Split(fpath)
+	err := os.MkdirAll(dir, 0700)
+	if err != nil {
+		return err
+	}
+
+	f, err := ioutil.TempFile(dir, "."+name+".tmp")
+	if err != nil {
+		return err
+	}
+	tmpPath := f.Name()
+	defer os.Remove(tmpPath)
+
+	_, err = f.Write(data)
+	if err == nil {
+		err = f.Sync()
+	}
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+
+	err = os.Chmod(tmpPath, perm)
+	if err != nil {
+		return err
+	}
+
+	if keepBackup && fileExists(fpath) {
+		err = backupFile(fpath)
+	} else {
+		err = removeBackup(fpath)
+	}
+	if err != nil {
+		return err
+	}
+
+	err = os.Rename(tmpPath, fpath)
+	if err != nil {
+		return err
+	}
+	return syncDir(dir)
+}
+
+// backupFile keep the current version of fpath as fpath.bak, hard linked when the file system allows it
+func backupFile(fpath string) error {
+	bakPath := fpath + backupSuffix
+	err := removeBackup(fpath)
+	if err != nil {
+		return err
+	}
+
+	if os.Link(fpath, bakPath) == nil {
+		return nil
+	}
+
+	data, err := ioutil.ReadFile(fpath)
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(bakPath, data, 0600)
+}
+
+// removeBackup remove fpath.bak if there is one
+func removeBackup(fpath string) error {
+	err := os.Remove(fpath + backupSuffix)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
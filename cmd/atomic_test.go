@@ -0,0 +1,97 @@
+//
+// Copyright © 2020 alexj@backpocket.com
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"os"
+	"testing"
+)
+
+func TestWriteFileAtomicBackup(t *testing.T) {
+	authyHome = t.TempDir()
+	passphrase = []byte("passphrase")
+	defer func() { authyHome, passphrase = "", nil }()
+
+	fpath, err := DataPath(localFileName)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, v := range []string{`[{"name":"one"}]`, `[{"name":"two"}]`} {
+		err = writeFileAtomic(fpath, []byte(v), 0600)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	if !fileExists(fpath + backupSuffix) {
+		t.Fatalf("expected %s to keep the previous plaintext version", fpath+backupSuffix)
+	}
+
+	err = writeSealedFile(fpath, localFilePurpose, []byte(`[{"name":"two"}]`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fileExists(fpath + backupSuffix) {
+		t.Fatalf("plaintext %s kept after encrypting %s", fpath+backupSuffix, fpath)
+	}
+
+	err = writeSealedFile(fpath, localFilePurpose, []byte(`[{"name":"three"}]`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !fileExists(fpath + backupSuffix) {
+		t.Fatalf("expected %s to keep the previous encrypted version", fpath+backupSuffix)
+	}
+}
+
+func TestSaveDeviceInfoBackup(t *testing.T) {
+	authyHome = t.TempDir()
+	defer func() { authyHome = "" }()
+
+	devInfo := &DeviceRegistration{UserID: 1, DeviceID: 2, MainPassword: "secret"}
+	for i := 0; i < 2; i++ {
+		err := SaveDeviceInfo(devInfo)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	fpath, err := ConfigPath(configFileName)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	devInfo.MainPassword = ""
+	err = SaveDeviceInfo(devInfo)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(fpath + backupSuffix); !os.IsNotExist(err) {
+		t.Fatalf("%s holding the backup password kept after it was removed, err: %v", fpath+backupSuffix, err)
+	}
+
+	err = SaveDeviceInfo(devInfo)
+	if err != nil {
+		t.Fatal(err)
+	}
+	bakInfo, err := readDeviceInfo(fpath + backupSuffix)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bakInfo.MainPassword != "" {
+		t.Fatalf("backup holds password: %s", bakInfo.MainPassword)
+	}
+}
@@ -0,0 +1,191 @@
+//
+// Copyright © 2020 alexj@backpocket.com
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+)
+
+const (
+	// backupFilePurpose authenticated with the encrypted backup archive
+	backupFilePurpose = "authy backup"
+
+	// backupVersion format version of the backup archive
+	backupVersion = 1
+)
+
+// backupArchive device registration, token cache and local tokens of a profile
+type backupArchive struct {
+	Version   int                 `json:"version"`
+	CreatedAt time.Time           `json:"created_at"`
+	Profile   string              `json:"profile"`
+	Device    *DeviceRegistration `json:"device"`
+	Cache     *tokenCache         `json:"cache,omitempty"`
+	Local     []*Token            `json:"local,omitempty"`
+}
+
+// backupCmd represents the backup command
+var backupCmd = &cobra.Command{
+	Use:   "backup",
+	Short: "write an encrypted backup of the device registration and tokens",
+	Long: `write an encrypted backup of the device registration and tokens
+
+The backup holds the device registration, the token cache and the local tokens of the selected profile.
+It is always encrypted with the passphrase ($AUTHY_PASSPHRASE or prompt), use restore to reinstate it.
+The backup password is not included, it stays with the password provider.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		out, err := cmd.Flags().GetString("out")
+		if err != nil || out == "" {
+			cmd.Help()
+			return
+		}
+
+		backupCmdRun(out)
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(backupCmd)
+	backupCmd.Flags().StringP("out", "o", "", "file to write the backup to")
+}
+
+// validate return an error if the archive can not be restored
+func (a *backupArchive) validate() error {
+	if a.Version != backupVersion {
+		return errors.Errorf("unsupported backup version: %d", a.Version)
+	}
+
+	if a.Device == nil || a.Device.UserID == 0 || a.Device.DeviceID == 0 || a.Device.Seed == "" {
+		return errors.New("backup has no device registration")
+	}
+
+	if a.Cache != nil && a.Cache.Version != cacheVersion {
+		return errors.Errorf("unsupported token cache version: %d", a.Cache.Version)
+	}
+	return nil
+}
+
+// newBackupArchive collect the device registration, token cache and local tokens of the selected profile
+func newBackupArchive() (*backupArchive, error) {
+	devInfo, err := LoadExistingDeviceInfo()
+	if os.IsNotExist(err) {
+		return nil, errors.Errorf("profile: %s has no device registration", profileName)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	c, err := loadTokenCache()
+	if os.IsNotExist(errors.Cause(err)) {
+		c, err = nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	local, err := loadLocalTokens()
+	if err != nil {
+		return nil, err
+	}
+
+	return &backupArchive{
+		Version:   backupVersion,
+		CreatedAt: time.Now().UTC(),
+		Profile:   profileName,
+		Device:    devInfo,
+		Cache:     c,
+		Local:     local,
+	}, nil
+}
+
+// readBackupArchive decrypt and validate the backup archive in file fpath
+func readBackupArchive(fpath string) (*backupArchive, error) {
+	data, err := ioutil.ReadFile(fpath)
+	if err != nil {
+		return nil, err
+	}
+
+	if !isSealed(data) {
+		return nil, errors.Errorf("%s is not an authy backup", fpath)
+	}
+
+	pass, err := getPassphrase(false)
+	if err != nil {
+		return nil, err
+	}
+
+	plaintext, err := unseal(data, pass, backupFilePurpose)
+	if err != nil {
+		return nil, errors.Wrapf(err, "unable to read file: %s", fpath)
+	}
+
+	a := &backupArchive{}
+	err = json.Unmarshal(plaintext, a)
+	if err != nil {
+		return nil, errors.Wrapf(err, "unable to read file: %s", fpath)
+	}
+
+	err = a.validate()
+	if err != nil {
+		return nil, errors.Wrapf(err, "invalid backup: %s", fpath)
+	}
+	return a, nil
+}
+
+func backupCmdRun(out string) {
+	a, err := newBackupArchive()
+	if err != nil {
+		fmt.Printf("Error %v\n", err)
+		return
+	}
+
+	data, err := json.Marshal(a)
+	if err != nil {
+		fmt.Printf("Error %v\n", err)
+		return
+	}
+
+	pass, err := getPassphrase(true)
+	if err != nil {
+		fmt.Printf("Error %v\n", err)
+		return
+	}
+
+	data, err = seal(data, pass, backupFilePurpose)
+	if err != nil {
+		fmt.Printf("Error %v\n", err)
+		return
+	}
+
+	err = ioutil.WriteFile(out, data, 0600)
+	if err != nil {
+		fmt.Printf("Error unable to write backup file: %s error: %v\n", out, err)
+		return
+	}
+
+	synced := 0
+	if a.Cache != nil {
+		synced = len(a.Cache.Tokens)
+	}
+	fmt.Printf("wrote backup of profile: %s with %d synced and %d local tokens to: %s\n", a.Profile, synced, len(a.Local), out)
+}
@@ -0,0 +1,281 @@
+//
+// Copyright © 2020 alexj@backpocket.com
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	// cacheFilePurpose authenticated with the encrypted token cache
+	cacheFilePurpose = "authy token cache"
+
+	// cacheVersion schema version of the token cache written by this version. Version 0 is the bare array of
+	// tokens written by earlier versions.
+	cacheVersion = 1
+
+	// maxCacheAgeEnv environment variable holding the max cache age, same as --max-cache-age
+	maxCacheAgeEnv = "AUTHY_MAX_CACHE_AGE"
+	// defaultMaxCacheAge age after which the token cache is refreshed from the authy server
+	defaultMaxCacheAge = 24 * time.Hour
+)
+
+var (
+	// maxCacheAge age after which the token cache is refreshed, 0 never refreshes
+	maxCacheAge time.Duration
+
+	// refreshCache refresh the token cache however new it is, set by the refresh command
+	refreshCache bool
+
+	// offline never contact the authy server, use the token cache however old it is
+	offline bool
+)
+
+// errCacheMismatch token cache was fetched for a different authy user or device
+var errCacheMismatch = errors.New("token cache belongs to a different user or device")
+
+// tokenCache on disk format of the token cache, the synced tokens and where and when they were fetched
+type tokenCache struct {
+	Version   int       `json:"version"`
+	FetchedAt time.Time `json:"fetched_at"`
+	UserID    uint64    `json:"user_id"`
+	DeviceID  uint64    `json:"device_id"`
+	Source    string    `json:"source"`
+	Tokens    []*Token  `json:"tokens"`
+}
+
+// getMaxCacheAge return the max cache age from --max-cache-age, else from AUTHY_MAX_CACHE_AGE
+func getMaxCacheAge() (time.Duration, error) {
+	if rootCmd.PersistentFlags().Changed("max-cache-age") {
+		return maxCacheAge, nil
+	}
+
+	env := os.Getenv(maxCacheAgeEnv)
+	if env == "" {
+		return maxCacheAge, nil
+	}
+
+	age, err := time.ParseDuration(env)
+	if err != nil {
+		return 0, errors.Wrapf(err, "invalid %s", maxCacheAgeEnv)
+	}
+	return age, nil
+}
+
+// isStale return true if the tokens were fetched more than maxAge ago, or when unknown. A maxAge of 0 is never stale.
+func (c *tokenCache) isStale(maxAge time.Duration) bool {
+	if maxAge <= 0 {
+		return false
+	}
+	return c.FetchedAt.IsZero() || time.Since(c.FetchedAt) > maxAge
+}
+
+// cacheMigrations upgrade a token cache from version i to version i+1, decoded is the file content
+var cacheMigrations = []func(c *tokenCache, decoded []byte) error{
+	migrateCacheV0,
+}
+
+// migrateCacheV0 wrap the bare array of tokens written by earlier versions. The fetch time and ids are unknown,
+// the ids are filled in by loadCachedTokens.
+func migrateCacheV0(c *tokenCache, decoded []byte) error {
+	c.Source = TokenSourceAuthy
+	return json.Unmarshal(decoded, &c.Tokens)
+}
+
+// decodeTokenCache decode the token cache in data and migrate it to cacheVersion. Returns true if it was migrated.
+func decodeTokenCache(data []byte) (*tokenCache, bool, error) {
+	c := &tokenCache{}
+	if !bytes.HasPrefix(bytes.TrimSpace(data), []byte("[")) {
+		err := json.Unmarshal(data, c)
+		if err != nil {
+			return nil, false, err
+		}
+	}
+
+	if c.Version > cacheVersion {
+		return nil, false, errors.Errorf("token cache version %d is newer than supported version %d", c.Version, cacheVersion)
+	}
+
+	migrated := c.Version < cacheVersion
+	for c.Version < cacheVersion {
+		err := cacheMigrations[c.Version](c, data)
+		if err != nil {
+			return nil, false, errors.Wrapf(err, "unable to migrate token cache from version %d", c.Version)
+		}
+		c.Version++
+	}
+	return c, migrated, nil
+}
+
+// loadTokenCache load the token cache, migrating caches written by earlier versions
+func loadTokenCache() (*tokenCache, error) {
+	fpath, err := CachePath(cacheFileName)
+	if err != nil {
+		return nil, err
+	}
+
+	data, sealed, err := readSealedFile(fpath, cacheFilePurpose)
+	if err != nil {
+		return nil, err
+	}
+
+	c, migrated, err := decodeTokenCache(data)
+	if err != nil {
+		return nil, errors.Wrapf(err, "unable to read file: %s", fpath)
+	}
+
+	if verbose {
+		fmt.Printf("Loaded cached providers from %v\n", fpath)
+	}
+
+	if migrated || (!sealed && !noEncrypt) {
+		// rewrite caches written by earlier versions
+		return updateTokenCache(func(c *tokenCache) error { return nil })
+	}
+	return c, nil
+}
+
+// updateTokenCache apply update to the token cache and save it, the cache is read and written with the lock held.
+// A missing cache is created. Returns the saved cache.
+func updateTokenCache(update func(c *tokenCache) error) (*tokenCache, error) {
+	fpath, err := CachePath(cacheFileName)
+	if err != nil {
+		return nil, err
+	}
+
+	c := &tokenCache{Source: TokenSourceAuthy}
+	err = updateSealedFile(fpath, cacheFilePurpose, func(data []byte) ([]byte, error) {
+		if data != nil {
+			var decodeErr error
+			c, _, decodeErr = decodeTokenCache(data)
+			if decodeErr != nil {
+				return nil, errors.Wrapf(decodeErr, "unable to read file: %s", fpath)
+			}
+		}
+
+		updateErr := update(c)
+		if updateErr != nil {
+			return nil, updateErr
+		}
+
+		c.Version = cacheVersion
+		return json.Marshal(c)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if verbose {
+		fmt.Printf("Saved tokens to file: %v\n", fpath)
+	}
+	return c, nil
+}
+
+// save write the token cache
+func (c *tokenCache) save() error {
+	fpath, err := CachePath(cacheFileName)
+	if err != nil {
+		return err
+	}
+
+	c.Version = cacheVersion
+	data, err := json.Marshal(c)
+	if err == nil {
+		err = writeSealedFile(fpath, cacheFilePurpose, data)
+	}
+	if err != nil {
+		return err
+	}
+	if verbose {
+		fmt.Printf("Saved tokens to file: %v\n", fpath)
+	}
+	return nil
+}
+
+// loadCachedTokens load the token cache holding the synced tokens of devInfo. Returns errCacheMismatch if the
+// cache was fetched for another user or device.
+func loadCachedTokens(devInfo *DeviceRegistration) (*tokenCache, error) {
+	c, err := loadTokenCache()
+	if err != nil {
+		return nil, err
+	}
+
+	if c.UserID == 0 && c.DeviceID == 0 {
+		// migrated cache, it was fetched for the registered device
+		c, err = updateTokenCache(func(c *tokenCache) error {
+			if c.UserID == 0 && c.DeviceID == 0 {
+				c.UserID = devInfo.UserID
+				c.DeviceID = devInfo.DeviceID
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if c.UserID != devInfo.UserID || c.DeviceID != devInfo.DeviceID {
+		return nil, errCacheMismatch
+	}
+	return c, nil
+}
+
+// cachedTokens return the synced tokens in the token cache on disk, none when there is no cache yet. Unlike
+// Initialize it never registers a device or contacts the authy server.
+func cachedTokens() ([]*Token, error) {
+	c, err := loadTokenCache()
+	if os.IsNotExist(errors.Cause(err)) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return c.Tokens, nil
+}
+
+// saveFetchedTokens replace the token cache with tokens just fetched from the authy server for devInfo
+func saveFetchedTokens(devInfo *DeviceRegistration, tks []*Token) error {
+	fpath, err := CachePath(cacheFileName)
+	if err != nil {
+		return err
+	}
+
+	err = unlockPassphrase(fpath)
+	if err != nil {
+		return err
+	}
+
+	unlock, err := lockFiles()
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	c := &tokenCache{
+		FetchedAt: time.Now().UTC(),
+		UserID:    devInfo.UserID,
+		DeviceID:  devInfo.DeviceID,
+		Source:    TokenSourceAuthy,
+		Tokens:    tks,
+	}
+	return c.save()
+}
@@ -21,20 +21,35 @@ import (
 	"fmt"
 	"github.com/alexj212/authy/totp"
 	"github.com/alexzorin/authy"
-	"github.com/mitchellh/go-homedir"
 	"github.com/pkg/errors"
-	"golang.org/x/crypto/ssh/terminal"
 	"log"
 	"os"
-	"path/filepath"
 	"strconv"
 	"strings"
 	"time"
 )
 
 const (
-	configFileName = ".authy.json"
-	cacheFileName  = ".authycache.json"
+	configFileName = "authy.json"
+	cacheFileName  = "cache.json"
+)
+
+const (
+	// TokenTypeTotp time based token, the default when Token.Type is empty
+	TokenTypeTotp = "totp"
+	// TokenTypeHotp counter based token
+	TokenTypeHotp = "hotp"
+	// TokenTypeSteam time based token generating Steam Guard codes
+	TokenTypeSteam = "steam"
+	// TokenTypeOcra challenge-response token, see Token.Suite
+	TokenTypeOcra = "ocra"
+)
+
+const (
+	// TokenSourceAuthy token synced from the authy server, the default when Token.Source is empty
+	TokenSourceAuthy = "authy"
+	// TokenSourceLocal token from the local token store
+	TokenSourceLocal = "local"
 )
 
 var verbose bool
@@ -61,13 +76,15 @@ var (
 	RuntimeVer string
 )
 
-// DeviceRegistration authy account details
+// DeviceRegistration authy account details. PasswordProvider is the spec of the CredentialProvider holding the
+// backup password, MainPassword is only read to migrate a password saved in plaintext by earlier versions.
 type DeviceRegistration struct {
-	UserID       uint64 `json:"user_id,omitempty"`
-	DeviceID     uint64 `json:"device_id,omitempty"`
-	Seed         string `json:"seed,omitempty"`
-	APIKey       string `json:"api_key,omitempty"`
-	MainPassword string `json:"main_password,omitempty"`
+	UserID           uint64 `json:"user_id,omitempty"`
+	DeviceID         uint64 `json:"device_id,omitempty"`
+	Seed             string `json:"seed,omitempty"`
+	APIKey           string `json:"api_key,omitempty"`
+	MainPassword     string `json:"main_password,omitempty"`
+	PasswordProvider string `json:"password_provider,omitempty"`
 }
 
 // Token save in cache
@@ -77,6 +94,12 @@ type Token struct {
 	Digital      int    `json:"digital"`
 	Secret       string `json:"secret"`
 	Period       int    `json:"period"`
+	Algorithm    string `json:"algorithm,omitempty"`
+	Type         string `json:"type,omitempty"`
+	Counter      uint64 `json:"counter,omitempty"`
+	Suite        string `json:"ocra_suite,omitempty"`
+	Issuer       string `json:"issuer,omitempty"`
+	Source       string `json:"source,omitempty"`
 }
 
 // Tokens type for results of search etc
@@ -94,97 +117,43 @@ func (ts Tokens) String(i int) string {
 // Len - number of Token results
 func (ts Tokens) Len() int { return len(ts) }
 
-func loadCachedTokens() ([]*Token, error) {
-	fpath, err := ConfigPath(cacheFileName)
-	if err != nil {
-		return nil, err
-	}
-
-	f, err := os.Open(fpath)
-	if err != nil {
-		return nil, err
-	}
-
-	defer f.Close()
-
-	tokens := []*Token{}
-	err = json.NewDecoder(f).Decode(tokens)
-	if err != nil {
-		return nil, err
-	}
-
-	if verbose {
-		fmt.Printf("Loaded cached providers from %v\n", fpath)
-	}
-	return tokens, err
-}
-
-func saveTokens(tks []*Token) error {
-	regrPath, err := ConfigPath(cacheFileName)
-	if err != nil {
-		return err
-	}
-
-	f, err := os.OpenFile(regrPath, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0600)
-	if err != nil {
-		return err
-	}
-
-	defer f.Close()
-	err = json.NewEncoder(f).Encode(tks)
-
-	if err != nil {
-		fmt.Printf("Error saving tokens: %v\n", err)
-		return err
-	}
-	if verbose {
-		fmt.Printf("Saved tokens to file: %v\n", regrPath)
-	}
-	return nil
-}
-
+// getTokensFromAuthyServer fetch and decrypt the tokens of devInfo from the authy server and save them to the
+// token cache
 func getTokensFromAuthyServer(devInfo *DeviceRegistration) ([]*Token, error) {
 	client, err := authy.NewClient()
 	if err != nil {
-		log.Fatalf("Create authy API client failed %+v", err)
+		return nil, errors.Wrap(err, "create authy API client failed")
 	}
 
 	apps, err := client.QueryAuthenticatorApps(nil, devInfo.UserID, devInfo.DeviceID, devInfo.Seed)
 	if err != nil {
-		log.Fatalf("Fetch authenticator apps failed %+v", err)
+		return nil, errors.Wrap(err, "fetch authenticator apps failed")
 	}
 
 	if !apps.Success {
-		log.Fatalf("Fetch authenticator apps failed %+v", apps)
+		return nil, errors.Errorf("fetch authenticator apps failed %+v", apps)
 	}
 
 	tokensResponse, err := client.QueryAuthenticatorTokens(nil, devInfo.UserID, devInfo.DeviceID, devInfo.Seed)
 	if err != nil {
-		log.Fatalf("Fetch authenticator tokens failed %+v", err)
+		return nil, errors.Wrap(err, "fetch authenticator tokens failed")
 	}
 
 	if !tokensResponse.Success {
-		log.Fatalf("Fetch authenticator tokens failed %+v", tokensResponse)
+		return nil, errors.Errorf("fetch authenticator tokens failed %+v", tokensResponse)
 	}
 
-	if len(devInfo.MainPassword) == 0 {
-		fmt.Print("\nPlease input Authy main password: ")
-		pp, err := terminal.ReadPassword(int(os.Stdin.Fd()))
-		if err != nil {
-			log.Fatalf("Get password failed %+v", err)
-		}
-
-		devInfo.MainPassword = strings.TrimSpace(string(pp))
-		SaveDeviceInfo(devInfo)
+	password, provider, err := getBackupPassword(devInfo)
+	if err != nil {
+		return nil, errors.Wrap(err, "get password failed")
 	}
 
 	tks := []*Token{}
 	for _, v := range tokensResponse.AuthenticatorTokens {
-		secret, err := v.Decrypt(devInfo.MainPassword)
+		secret, err := v.Decrypt(password)
 		if err != nil {
-			devInfo.MainPassword = ""
-			SaveDeviceInfo(devInfo)
-			log.Fatalf("Decrypt token failed %+v", err)
+			provider.Forget()
+			return nil, errors.Wrap(err, "decrypt token failed")
 		}
 
 		if verbose {
@@ -196,13 +165,19 @@ func getTokensFromAuthyServer(devInfo *DeviceRegistration) ([]*Token, error) {
 			OriginalName: v.OriginalName,
 			Digital:      v.Digits,
 			Secret:       secret,
+			Source:       TokenSourceAuthy,
 		})
 	}
 
+	err = provider.Store(password)
+	if err != nil {
+		fmt.Printf("Error unable to save backup password: %v\n", err)
+	}
+
 	for _, v := range apps.AuthenticatorApps {
 		secret, err := v.Token()
 		if err != nil {
-			log.Fatal("Get secret from app failed", err)
+			return nil, errors.Wrap(err, "get secret from app failed")
 		}
 		if verbose {
 			fmt.Printf("AuthenticatorApps: %v\n", v.Name)
@@ -213,10 +188,15 @@ func getTokensFromAuthyServer(devInfo *DeviceRegistration) ([]*Token, error) {
 			Digital: v.Digits,
 			Secret:  secret,
 			Period:  10,
+			Source:  TokenSourceAuthy,
 		})
 	}
 
-	saveTokens(tks)
+	err = saveFetchedTokens(devInfo, tks)
+	if err != nil {
+		// the fetched tokens are still usable, they are fetched again next time
+		fmt.Printf("Error unable to save token cache: %v\n", err)
+	}
 	return tks, nil
 }
 
@@ -236,14 +216,148 @@ func findToken(tokens []*Token, tokenName string) (*Token, error) {
 	return tk, nil
 }
 
+// GetPeriod return the token period in seconds, defaulting to totp.Interval when not set
+func (tk *Token) GetPeriod() int {
+	if tk.Period <= 0 {
+		return totp.Interval
+	}
+	return tk.Period
+}
+
+// IsHotp return true if token is counter based
+func (tk *Token) IsHotp() bool {
+	return strings.EqualFold(tk.Type, TokenTypeHotp)
+}
+
+// IsOcra return true if token is a challenge-response token
+func (tk *Token) IsOcra() bool {
+	return strings.EqualFold(tk.Type, TokenTypeOcra)
+}
+
+// GetEncoding return the format codes are rendered in, steam tokens use totp.EncodingSteam
+func (tk *Token) GetEncoding() totp.Encoding {
+	if strings.EqualFold(tk.Type, TokenTypeSteam) {
+		return totp.EncodingSteam
+	}
+	return totp.EncodingDecimal
+}
+
+// GetAlgorithm return the token hmac algorithm, defaulting to sha1 when not set
+func (tk *Token) GetAlgorithm() (totp.Algorithm, error) {
+	algorithm, err := totp.ParseAlgorithm(tk.Algorithm)
+	if err != nil {
+		return algorithm, errors.Wrapf(err, "invalid algorithm for token: %s", tk.Name)
+	}
+	return algorithm, nil
+}
+
+// GetSecret return the token secret in canonical base32. Leftover bits of the last character, which earlier
+// versions ignored, are dropped so cached secrets keep generating codes.
+func (tk *Token) GetSecret() (string, error) {
+	secret, err := totp.NormalizeSecret(tk.Secret)
+	if err != nil {
+		return "", errors.Wrapf(err, "invalid secret for token: %s", tk.Name)
+	}
+	return secret, nil
+}
+
+// GetHotpCode return code for the current counter and advance the counter, caller is responsible for saving the token
+func (tk *Token) GetHotpCode() (string, error) {
+	algorithm, err := tk.GetAlgorithm()
+	if err != nil {
+		return "", err
+	}
+
+	secret, err := tk.GetSecret()
+	if err != nil {
+		return "", err
+	}
+
+	code, err := totp.GetHotpCode(secret, tk.Counter, tk.Digital, algorithm)
+	if err != nil {
+		return "", errors.Wrapf(err, "unable to generate code for token: %s", tk.Name)
+	}
+
+	tk.Counter++
+	return code, nil
+}
+
 // GetTotpCode return code and # of seconds left in current code
-func (tk *Token) GetTotpCode() (string, int) {
-	codes := totp.GetTotpCode(tk.Secret, tk.Digital)
-	challenge := totp.GetChallenge()
+func (tk *Token) GetTotpCode() (string, int, error) {
+	return tk.GetTotpCodeAt(time.Now())
+}
+
+// GetTotpCodeAt return code for the step containing t and # of seconds from t until the end of the step
+func (tk *Token) GetTotpCodeAt(t time.Time) (string, int, error) {
+	period := tk.GetPeriod()
+	challenge := totp.GetChallengeAt(t, period)
+	code, err := tk.GetTotpCodeForStep(challenge)
+	if err != nil {
+		return "", 0, err
+	}
+
+	secsLeft := period - int(t.Unix()-challenge*int64(period))
+	return code, secsLeft, nil
+}
+
+// GetTotpCodeForStep return code for time step, the number of periods since the unix epoch
+func (tk *Token) GetTotpCodeForStep(step int64) (string, error) {
+	algorithm, err := tk.GetAlgorithm()
+	if err != nil {
+		return "", err
+	}
+
+	secret, err := tk.GetSecret()
+	if err != nil {
+		return "", err
+	}
+
+	code, err := totp.GenerateEncodedCode(secret, step, tk.Digital, algorithm, tk.GetEncoding())
+	if err != nil {
+		return "", errors.Wrapf(err, "unable to generate code for token: %s", tk.Name)
+	}
+	return code, nil
+}
+
+// waitForTotpCode return code and # of seconds left, blocking till the code has at least MinTimeLeft seconds
+// left. MinTimeLeft is capped to a third of the token period so short period tokens do not wait a full cycle.
+func waitForTotpCode(tk *Token) (string, int, error) {
+	minTimeLeft := MinTimeLeft
+	if max := tk.GetPeriod() / 3; minTimeLeft > max {
+		minTimeLeft = max
+	}
 
-	secsLeft := 30 - int(time.Now().Unix()-challenge*30)
-	code := codes[1]
-	return code, secsLeft
+	code, timeLeft, err := tk.GetTotpCode()
+	for err == nil && timeLeft < minTimeLeft {
+		if verbose {
+			fmt.Printf("Got code but time left %d < %d, waiting for next code\n", timeLeft, minTimeLeft)
+		}
+		time.Sleep(time.Duration(timeLeft) * time.Second)
+		code, timeLeft, err = tk.GetTotpCode()
+	}
+	return code, timeLeft, err
+}
+
+// generateCode return code for token and # of seconds left, 0 for hotp tokens. The counter of hotp tokens is
+// advanced and saved to the store owning the token before the code is returned.
+func generateCode(tk *Token) (string, int, error) {
+	if tk.IsOcra() {
+		return "", 0, errors.Errorf("token: %s is an ocra token, use respond with a challenge", tk.Name)
+	}
+
+	if !tk.IsHotp() {
+		return waitForTotpCode(tk)
+	}
+
+	var code string
+	err := tk.updateCounter(func() (err error) {
+		code, err = tk.GetHotpCode()
+		return err
+	})
+	if err != nil {
+		return "", 0, errors.Wrapf(err, "unable to advance counter for token: %s", tk.Name)
+	}
+	return code, 0, nil
 }
 
 // SaveDeviceInfo ..
@@ -253,13 +367,26 @@ func SaveDeviceInfo(devInfo *DeviceRegistration) error {
 		return err
 	}
 
-	f, err := os.OpenFile(regrPath, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0600)
+	data, err := json.Marshal(devInfo)
+	if err != nil {
+		return err
+	}
+
+	unlock, err := lockFiles()
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	// the previous version is not kept once the plaintext backup password is removed from it
+	prev, err := readDeviceInfo(regrPath)
+	keepBackup := devInfo.MainPassword != "" || (err == nil && prev.MainPassword == "")
+
+	err = replaceFile(regrPath, append(data, '\n'), 0600, keepBackup)
 	if err != nil {
 		return err
 	}
 
-	defer f.Close()
-	err = json.NewEncoder(f).Encode(devInfo)
 	if verbose {
 		fmt.Printf("Save device info to file: %s\n", regrPath)
 	}
@@ -274,32 +401,54 @@ func LoadExistingDeviceInfo() (*DeviceRegistration, error) {
 		os.Exit(1)
 	}
 
-	f, err := os.Open(devPath)
+	devInfo, err := readDeviceInfo(devPath)
+	if err != nil && !os.IsNotExist(err) {
+		// a corrupt file would mean registering the device again, fall back to the previous version
+		bakInfo, bakErr := readDeviceInfo(devPath + backupSuffix)
+		if bakErr != nil {
+			return nil, err
+		}
+
+		fmt.Printf("unable to read device info file: %s error: %v, using backup\n", devPath, err)
+		devInfo = bakInfo
+	}
+	if err != nil && devInfo == nil {
+		return nil, err
+	}
+
+	if verbose {
+		fmt.Printf("Loaded device info from file: %s\n", devPath)
+	}
+
+	return devInfo, nil
+}
+
+// readDeviceInfo decode device info from file fpath
+func readDeviceInfo(fpath string) (*DeviceRegistration, error) {
+	f, err := os.Open(fpath)
 	if err != nil {
 		return nil, err
 	}
 	defer f.Close()
+
 	devInfo := &DeviceRegistration{}
 	err = json.NewDecoder(f).Decode(devInfo)
 	if err != nil {
 		return nil, err
 	}
-
-	if verbose {
-		fmt.Printf("Loaded device info from file: %s\n", configFileName)
-	}
-
 	return devInfo, nil
 }
 
-// ConfigPath get config file path
-func ConfigPath(fname string) (string, error) {
-	devPath, err := homedir.Dir()
-	if err != nil {
-		return "", err
+// confirm ask a yes/no question on stdin, returns true if the answer starts with y
+func confirm(question string) bool {
+	fmt.Printf("%s [y/N]: ", question)
+	sc := bufio.NewScanner(os.Stdin)
+	if !sc.Scan() {
+		return false
 	}
 
-	return filepath.Join(devPath, fname), nil
+	answer := strings.ToLower(strings.TrimSpace(sc.Text()))
+	return strings.HasPrefix(answer, "y")
 }
 
 func promptAccountInfo() (phoneCC int, mobile string, err error) {
@@ -432,12 +581,66 @@ func newRegistrationDevice() (*DeviceRegistration, error) {
 	return devInfo, nil
 }
 
+// loadTokens return the synced tokens of devInfo from the token cache, refreshing the cache from the authy server
+// when it is older than the max cache age. The stale cache is used when the refresh fails. The server is never
+// contacted with --offline.
+func loadTokens(devInfo *DeviceRegistration) ([]*Token, error) {
+	maxAge, err := getMaxCacheAge()
+	if err != nil {
+		fmt.Printf("error %v\n", err)
+		return nil, err
+	}
+
+	c, err := loadCachedTokens(devInfo)
+	if err != nil && errors.Cause(err) == errWrongPassphrase {
+		fmt.Printf("error loading token cache: %v\n", err)
+		return nil, err
+	}
+
+	if err != nil && offline {
+		fmt.Printf("error loading token cache: %v\n", err)
+		return nil, errors.Wrap(err, "no usable token cache while offline")
+	}
+
+	if err == nil && (offline || !(refreshCache || c.isStale(maxAge))) {
+		fmt.Printf("\nLoaded %d auth tokens from cache\n\n", len(c.Tokens))
+		return c.Tokens, nil
+	}
+
+	if err != nil && verbose && !os.IsNotExist(errors.Cause(err)) {
+		fmt.Printf("unable to use token cache: %v\n", err)
+	}
+
+	tokens, fetchErr := getTokensFromAuthyServer(devInfo)
+	if fetchErr != nil && err == nil && !refreshCache {
+		fmt.Printf("Warning unable to refresh token cache fetched %s, using cached tokens: %v\n", fetchedAtString(c.FetchedAt), fetchErr)
+		fmt.Printf("\nLoaded %d auth tokens from cache\n\n", len(c.Tokens))
+		return c.Tokens, nil
+	}
+	if fetchErr != nil {
+		fmt.Printf("error getTokensFromAuthyServer: %v\n", fetchErr)
+		return nil, fetchErr
+	}
+
+	fmt.Printf("\nLoaded %d auth tokens from authy server\n\n", len(tokens))
+	return tokens, nil
+}
+
+// fetchedAtString format the time the token cache was fetched, which is unknown for migrated caches
+func fetchedAtString(t time.Time) string {
+	if t.IsZero() {
+		return "at an unknown time"
+	}
+	return t.Local().Format(time.RFC3339)
+}
+
 // Initialize initialize device info and cached tokens
 func Initialize() (*DeviceRegistration, []*Token, error) {
-
 	devInfo, err := LoadExistingDeviceInfo()
-
-	if err != nil && os.IsNotExist(err) {
+	if err != nil && os.IsNotExist(err) && offline {
+		log.Println("Device is not registered, registration is not possible while offline")
+		return nil, nil, err
+	} else if err != nil && os.IsNotExist(err) {
 		devInfo, err = newRegistrationDevice()
 		if err != nil {
 			log.Printf("Registration Device failed error: %+v\n", err)
@@ -450,15 +653,28 @@ func Initialize() (*DeviceRegistration, []*Token, error) {
 		return nil, nil, err
 	}
 
-	tokens, err := loadCachedTokens()
-	if err != nil {
-		tokens, err = getTokensFromAuthyServer(devInfo)
+	if passwordProvider != "" && passwordProvider != devInfo.PasswordProvider {
+		err = setPasswordProvider(devInfo, passwordProvider)
 		if err != nil {
-			fmt.Printf("error getTokensFromAuthyServer: %v\n", err)
+			log.Printf("Set password provider failed %v", err)
 			return nil, nil, err
 		}
 	}
 
-	fmt.Printf("\nLoaded %d auth tokens from authy server\n\n", len(tokens))
+	tokens, err := loadTokens(devInfo)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	local, err := loadLocalTokens()
+	if err != nil {
+		fmt.Printf("error loading local tokens: %v\n", err)
+		return nil, nil, err
+	}
+
+	if len(local) > 0 {
+		fmt.Printf("Loaded %d local tokens\n\n", len(local))
+		tokens = append(tokens, local...)
+	}
 	return devInfo, tokens, nil
 }
@@ -0,0 +1,299 @@
+//
+// Copyright © 2020 alexj@backpocket.com
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	// ProviderPrompt prompt for the backup password every time it is needed, it is never persisted
+	ProviderPrompt = "prompt"
+	// ProviderEnv read the backup password from an environment variable, env or env:NAME
+	ProviderEnv = "env"
+	// ProviderCommand run a command and use the first line of its output, cmd:COMMAND e.g. cmd:pass show authy
+	ProviderCommand = "cmd"
+	// ProviderFile keep the backup password in a file encrypted with the passphrase, the default
+	ProviderFile = "file"
+
+	// defaultPasswordEnv environment variable read by the env provider when no name is given
+	defaultPasswordEnv = "AUTHY_PASSWORD"
+
+	passwordFileName    = "password.json"
+	passwordFilePurpose = "authy backup password"
+)
+
+// CredentialProvider source of the authy backup password, which decrypts the tokens synced from authy
+type CredentialProvider interface {
+	// Password return the backup password
+	Password() (string, error)
+	// Store remember a password that decrypted the tokens, providers that do not persist ignore it
+	Store(password string) error
+	// Forget remove a remembered password
+	Forget() error
+	// String provider spec
+	String() string
+}
+
+// NewCredentialProvider create provider from spec, NAME or NAME:ARG. An empty spec is the file provider.
+func NewCredentialProvider(spec string) (CredentialProvider, error) {
+	name, arg := spec, ""
+	if i := strings.Index(spec, ":"); i >= 0 {
+		name, arg = spec[:i], strings.TrimSpace(spec[i+1:])
+	}
+
+	switch strings.ToLower(strings.TrimSpace(name)) {
+	case ProviderPrompt:
+		return promptProvider{}, nil
+	case ProviderEnv:
+		if arg == "" {
+			arg = defaultPasswordEnv
+		}
+		return envProvider{name: arg}, nil
+	case ProviderCommand:
+		if arg == "" {
+			return nil, errors.New("cmd password provider requires a command, e.g. cmd:pass show authy")
+		}
+		return commandProvider{command: arg}, nil
+	case ProviderFile, "":
+		return fileProvider{}, nil
+	}
+	return nil, errors.Errorf("unknown password provider: %s, expected one of prompt, env[:NAME], cmd:COMMAND, file", spec)
+}
+
+// promptProvider ask for the password on the terminal
+type promptProvider struct{}
+
+func (promptProvider) Password() (string, error) {
+	pp, err := readPassword("\nPlease input Authy main password: ")
+	if err != nil {
+		return "", err
+	}
+	return string(pp), nil
+}
+
+func (promptProvider) Store(password string) error { return nil }
+func (promptProvider) Forget() error               { return nil }
+func (promptProvider) String() string              { return ProviderPrompt }
+
+// envProvider read the password from an environment variable
+type envProvider struct {
+	name string
+}
+
+func (p envProvider) Password() (string, error) {
+	password := os.Getenv(p.name)
+	if password == "" {
+		return "", errors.Errorf("environment variable %s is not set", p.name)
+	}
+	return password, nil
+}
+
+func (p envProvider) Store(password string) error { return nil }
+func (p envProvider) Forget() error               { return nil }
+func (p envProvider) String() string              { return ProviderEnv + ":" + p.name }
+
+// commandProvider run a command and read the password from the first line of its output
+type commandProvider struct {
+	command string
+}
+
+func (p commandProvider) Password() (string, error) {
+	args := strings.Fields(p.command)
+	cmd := exec.Command(args[0], args[1:]...)
+	cmd.Stdin = os.Stdin
+	cmd.Stderr = os.Stderr
+	out, err := cmd.Output()
+	if err != nil {
+		return "", errors.Wrapf(err, "password command failed: %s", p.command)
+	}
+
+	password := strings.TrimSpace(strings.SplitN(string(out), "\n", 2)[0])
+	if password == "" {
+		return "", errors.Errorf("password command returned no password: %s", p.command)
+	}
+	return password, nil
+}
+
+func (p commandProvider) Store(password string) error { return nil }
+func (p commandProvider) Forget() error               { return nil }
+func (p commandProvider) String() string              { return ProviderCommand + ":" + p.command }
+
+// fileProvider keep the password in a file encrypted with the passphrase, prompting when there is none yet
+type fileProvider struct{}
+
+func (fileProvider) Password() (string, error) {
+	fpath, err := ConfigPath(passwordFileName)
+	if err != nil {
+		return "", err
+	}
+
+	data, err := ioutil.ReadFile(fpath)
+	if os.IsNotExist(err) {
+		return promptProvider{}.Password()
+	}
+	if err != nil {
+		return "", err
+	}
+
+	err = checkFilePassphrase()
+	if err != nil {
+		return "", err
+	}
+
+	pass, err := getPassphrase(false)
+	if err != nil {
+		return "", err
+	}
+
+	password, err := unseal(data, pass, passwordFilePurpose)
+	if err != nil {
+		return "", errors.Wrapf(err, "unable to read file: %s", fpath)
+	}
+	return string(password), nil
+}
+
+// Store encrypt password to file, the file is always encrypted regardless of --no-encrypt. The file is left
+// untouched when it already holds password. With --no-encrypt the passphrase is never prompted for, it must be
+// in AUTHY_PASSPHRASE.
+func (p fileProvider) Store(password string) error {
+	fpath, err := ConfigPath(passwordFileName)
+	if err != nil {
+		return err
+	}
+
+	err = checkFilePassphrase()
+	if err != nil {
+		return err
+	}
+
+	if passphrase != nil && fileExists(fpath) {
+		if current, err := p.Password(); err == nil && current == password {
+			return nil
+		}
+	}
+
+	pass, err := getPassphrase(true)
+	if err != nil {
+		return err
+	}
+
+	data, err := seal([]byte(password), pass, passwordFilePurpose)
+	if err != nil {
+		return err
+	}
+
+	err = writeFileAtomic(fpath, data, 0600)
+	if err != nil {
+		return err
+	}
+
+	if verbose {
+		fmt.Printf("Saved backup password to file: %s\n", fpath)
+	}
+	return nil
+}
+
+func (fileProvider) Forget() error {
+	fpath, err := ConfigPath(passwordFileName)
+	if err != nil {
+		return err
+	}
+
+	for _, v := range []string{fpath, fpath + backupSuffix} {
+		err = os.Remove(v)
+		if err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	return nil
+}
+
+func (fileProvider) String() string { return ProviderFile }
+
+// checkFilePassphrase return an error if the passphrase of the password file would be prompted for with
+// --no-encrypt, which never prompts
+func checkFilePassphrase() error {
+	if noEncrypt && passphrase == nil && os.Getenv(passphraseEnv) == "" {
+		return errors.Errorf("the %s password provider encrypts the password with a passphrase, with --no-encrypt set $%s or use --password-provider %s",
+			ProviderFile, passphraseEnv, ProviderEnv)
+	}
+	return nil
+}
+
+// credentialProvider return the provider the device registration uses for the backup password
+func (devInfo *DeviceRegistration) credentialProvider() (CredentialProvider, error) {
+	return NewCredentialProvider(devInfo.PasswordProvider)
+}
+
+// getBackupPassword return the backup password from the device's provider. A plaintext password saved in the
+// device info by earlier versions is moved to the provider and removed from the device info.
+func getBackupPassword(devInfo *DeviceRegistration) (string, CredentialProvider, error) {
+	provider, err := devInfo.credentialProvider()
+	if err != nil {
+		return "", nil, err
+	}
+
+	if devInfo.MainPassword != "" {
+		password := devInfo.MainPassword
+		err = provider.Store(password)
+		if err != nil {
+			// keep using the saved password, the migration is retried next time
+			fmt.Printf("Error unable to migrate saved backup password: %v\n", err)
+			return password, provider, nil
+		}
+
+		devInfo.MainPassword = ""
+		err = SaveDeviceInfo(devInfo)
+		if err != nil {
+			return "", nil, err
+		}
+		return password, provider, nil
+	}
+
+	password, err := provider.Password()
+	if err != nil {
+		return "", nil, err
+	}
+	return password, provider, nil
+}
+
+// setPasswordProvider switch the device registration to the provider in spec, a password remembered by the
+// previous provider is forgotten
+func setPasswordProvider(devInfo *DeviceRegistration, spec string) error {
+	provider, err := NewCredentialProvider(spec)
+	if err != nil {
+		return err
+	}
+
+	previous, err := devInfo.credentialProvider()
+	if err == nil && previous.String() != provider.String() {
+		err = previous.Forget()
+		if err != nil {
+			return err
+		}
+	}
+
+	devInfo.PasswordProvider = provider.String()
+	devInfo.MainPassword = ""
+	return SaveDeviceInfo(devInfo)
+}
@@ -0,0 +1,272 @@
+//
+// Copyright © 2020 alexj@backpocket.com
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+
+	"github.com/pkg/errors"
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/chacha20poly1305"
+	"golang.org/x/crypto/ssh/terminal"
+)
+
+const (
+	// passphraseEnv environment variable holding the passphrase used to encrypt files at rest
+	passphraseEnv = "AUTHY_PASSPHRASE"
+
+	sealedVersion = 1
+	sealedKDF     = "argon2id"
+
+	// argon2id parameters, RFC 9106 second recommended option
+	argonTime    = 3
+	argonMemory  = 64 * 1024
+	argonThreads = 4
+	argonSaltLen = 16
+)
+
+var (
+	// noEncrypt write files in plaintext, for CI and other non-interactive use
+	noEncrypt bool
+
+	// passphrase unlocked for this run, prompted for at most once
+	passphrase []byte
+
+	// errWrongPassphrase sealed file could not be decrypted
+	errWrongPassphrase = errors.New("unable to decrypt, wrong passphrase or corrupt file")
+)
+
+// sealedFile file encrypted with a key derived from the passphrase. Byte fields are base64 encoded by encoding/json.
+type sealedFile struct {
+	Version int    `json:"version"`
+	KDF     string `json:"kdf"`
+	Time    uint32 `json:"time"`
+	Memory  uint32 `json:"memory"`
+	Threads uint8  `json:"threads"`
+	Salt    []byte `json:"salt"`
+	Nonce   []byte `json:"nonce"`
+	Data    []byte `json:"data"`
+}
+
+// getPassphrase return the passphrase from AUTHY_PASSPHRASE or prompt for it. confirm asks twice, it is used
+// when the passphrase is about to encrypt a file without having decrypted one first.
+func getPassphrase(confirm bool) ([]byte, error) {
+	if passphrase != nil {
+		return passphrase, nil
+	}
+
+	if env := os.Getenv(passphraseEnv); env != "" {
+		passphrase = []byte(env)
+		return passphrase, nil
+	}
+
+	prompt := "\nPlease input passphrase to unlock authy files: "
+	if confirm {
+		prompt = "\nPlease input passphrase to encrypt authy files: "
+	}
+
+	pp, err := readPassword(prompt)
+	if err != nil {
+		return nil, err
+	}
+
+	if confirm {
+		again, err := readPassword("\nConfirm passphrase: ")
+		if err != nil {
+			return nil, err
+		}
+
+		if !bytes.Equal(pp, again) {
+			return nil, errors.New("passphrases do not match")
+		}
+	}
+
+	if len(pp) == 0 {
+		return nil, errors.New("empty passphrase")
+	}
+
+	passphrase = pp
+	return passphrase, nil
+}
+
+// readPassword prompt for a secret on the terminal without echo
+func readPassword(prompt string) ([]byte, error) {
+	fmt.Print(prompt)
+	pp, err := terminal.ReadPassword(int(os.Stdin.Fd()))
+	fmt.Println()
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to read from terminal")
+	}
+	return []byte(strings.TrimSpace(string(pp))), nil
+}
+
+// seal encrypt plaintext with a key derived from pass, purpose is authenticated so files of one kind can not be
+// substituted for another
+func seal(plaintext, pass []byte, purpose string) ([]byte, error) {
+	sf := &sealedFile{
+		Version: sealedVersion,
+		KDF:     sealedKDF,
+		Time:    argonTime,
+		Memory:  argonMemory,
+		Threads: argonThreads,
+		Salt:    make([]byte, argonSaltLen),
+		Nonce:   make([]byte, chacha20poly1305.NonceSizeX),
+	}
+
+	_, err := rand.Read(sf.Salt)
+	if err == nil {
+		_, err = rand.Read(sf.Nonce)
+	}
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to read random bytes")
+	}
+
+	aead, err := chacha20poly1305.NewX(sf.key(pass))
+	if err != nil {
+		return nil, err
+	}
+
+	sf.Data = aead.Seal(nil, sf.Nonce, plaintext, []byte(purpose))
+	return json.Marshal(sf)
+}
+
+// unseal decrypt data written by seal
+func unseal(data, pass []byte, purpose string) ([]byte, error) {
+	sf := &sealedFile{}
+	err := json.Unmarshal(data, sf)
+	if err != nil {
+		return nil, err
+	}
+
+	if sf.Version != sealedVersion || sf.KDF != sealedKDF {
+		return nil, errors.Errorf("unsupported encrypted file version: %d kdf: %s", sf.Version, sf.KDF)
+	}
+
+	aead, err := chacha20poly1305.NewX(sf.key(pass))
+	if err != nil {
+		return nil, err
+	}
+
+	if len(sf.Nonce) != aead.NonceSize() {
+		return nil, errors.Errorf("invalid nonce length: %d", len(sf.Nonce))
+	}
+
+	plaintext, err := aead.Open(nil, sf.Nonce, sf.Data, []byte(purpose))
+	if err != nil {
+		return nil, errWrongPassphrase
+	}
+	return plaintext, nil
+}
+
+func (sf *sealedFile) key(pass []byte) []byte {
+	return argon2.IDKey(pass, sf.Salt, sf.Time, sf.Memory, sf.Threads, chacha20poly1305.KeySize)
+}
+
+// isSealed return true if data was written by seal rather than being a plaintext json file
+func isSealed(data []byte) bool {
+	probe := struct {
+		KDF string `json:"kdf"`
+	}{}
+	return json.Unmarshal(data, &probe) == nil && probe.KDF != ""
+}
+
+// readSealedFile read file, decrypting it when it is encrypted. Returns the plaintext and if the file was encrypted.
+func readSealedFile(fpath, purpose string) ([]byte, bool, error) {
+	data, err := ioutil.ReadFile(fpath)
+	if err != nil {
+		return nil, false, err
+	}
+
+	if !isSealed(data) {
+		return data, false, nil
+	}
+
+	pass, err := getPassphrase(false)
+	if err != nil {
+		return nil, true, err
+	}
+
+	plaintext, err := unseal(data, pass, purpose)
+	if err != nil {
+		return nil, true, errors.Wrapf(err, "unable to read file: %s", fpath)
+	}
+	return plaintext, true, nil
+}
+
+// writeSealedFile write data to file, encrypted with the passphrase unless --no-encrypt was given
+func writeSealedFile(fpath, purpose string, data []byte) error {
+	if !noEncrypt {
+		pass, err := getPassphrase(true)
+		if err != nil {
+			return err
+		}
+
+		data, err = seal(data, pass, purpose)
+		if err != nil {
+			return err
+		}
+	}
+
+	return writeFileAtomic(fpath, data, 0600)
+}
+
+// updateSealedFile read fpath, pass its plaintext to update and write the data update returns, with the lock held
+// from the read to the write. update gets nil data when fpath does not exist. The passphrase is unlocked before
+// the lock is taken, so a prompt never holds up other authy processes.
+func updateSealedFile(fpath, purpose string, update func(data []byte) ([]byte, error)) error {
+	err := unlockPassphrase(fpath)
+	if err != nil {
+		return err
+	}
+
+	unlock, err := lockFiles()
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	data, _, err := readSealedFile(fpath, purpose)
+	if os.IsNotExist(err) {
+		data, err = nil, nil
+	}
+	if err != nil {
+		return err
+	}
+
+	data, err = update(data)
+	if err != nil {
+		return err
+	}
+	return writeSealedFile(fpath, purpose, data)
+}
+
+// unlockPassphrase get the passphrase needed to read and write fpath, if any
+func unlockPassphrase(fpath string) error {
+	data, err := ioutil.ReadFile(fpath)
+	sealed := err == nil && isSealed(data)
+	if passphrase != nil || (noEncrypt && !sealed) {
+		return nil
+	}
+
+	_, err = getPassphrase(!sealed)
+	return err
+}
@@ -41,7 +41,20 @@ func deleteDevInfoPassword(cmd *cobra.Command, args []string) {
 		log.Fatal("Load device info failed", err)
 	}
 
+	provider, err := devInfo.credentialProvider()
+	if err != nil {
+		log.Fatal("Load password provider failed", err)
+	}
+
+	err = provider.Forget()
+	if err != nil {
+		log.Fatal("Delete backup password failed", err)
+	}
+
 	devInfo.MainPassword = ""
-	SaveDeviceInfo(devInfo)
+	err = SaveDeviceInfo(devInfo)
+	if err != nil {
+		log.Fatal("Save device info failed", err)
+	}
 	log.Println("Backup password delete successfully!")
 }
@@ -94,18 +94,14 @@ func execCmdRun(tokenName, script, replacementToken string, dryRun bool) {
 	args := strings.Split(script, " ")
 
 	if !fileExists(args[0]) {
-		fmt.Print("exec script: %s does not exist\n")
+		fmt.Printf("exec script: %s does not exist\n", args[0])
 		return
 	}
 
-	var code string
-	var timeLeft int
-
-	for ok := true; ok; ok = timeLeft < MinTimeLeft {
-		code, timeLeft = token.GetTotpCode()
-		if !ok && verbose {
-			fmt.Printf("Got code but time left < %d\n", MinTimeLeft)
-		}
+	code, timeLeft, err := generateCode(token)
+	if err != nil {
+		fmt.Printf("Error %v\n", err)
+		return
 	}
 
 	for i, val := range args {
@@ -114,7 +110,11 @@ func execCmdRun(tokenName, script, replacementToken string, dryRun bool) {
 
 	if dryRun || verbose {
 		fmt.Printf("code: %v\n", code)
-		fmt.Printf("timeLeft: %v\n", timeLeft)
+		if token.IsHotp() {
+			fmt.Printf("counter: %v\n", token.Counter-1)
+		} else {
+			fmt.Printf("timeLeft: %v\n", timeLeft)
+		}
 		fmt.Printf("orig script: %v\n", script)
 	}
 
@@ -17,8 +17,14 @@ package cmd
 
 import (
 	"fmt"
-	//"time"
+	"os"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
 
+	"github.com/alexj212/authy/totp"
+	"github.com/pkg/errors"
 	"github.com/spf13/cobra"
 )
 
@@ -29,6 +35,9 @@ var generateCmd = &cobra.Command{
 	Use:   "generate [TokenName]",
 	Short: "generate a otp token",
 	Long: `generate a otp token
+
+--at, --offset and --steps print a table of the codes of a totp token around a given time
+instead of the current code, e.g. to debug logins against a server with a skewed clock.
 `,
 	Run: func(cmd *cobra.Command, args []string) {
 
@@ -39,13 +48,38 @@ var generateCmd = &cobra.Command{
 
 		tokenName := args[0]
 
+		at, err := cmd.Flags().GetString("at")
+		if err != nil {
+			cmd.Help()
+			return
+		}
+
+		offset, err := cmd.Flags().GetDuration("offset")
+		if err != nil {
+			cmd.Help()
+			return
+		}
+
+		steps, err := cmd.Flags().GetString("steps")
+		if err != nil {
+			cmd.Help()
+			return
+		}
+
 		fmt.Printf("tokenName: %s\n", tokenName)
+		if at != "" || offset != 0 || steps != "" {
+			generateTableCmdRun(tokenName, at, offset, steps)
+			return
+		}
 		generateCmdRun(tokenName)
 	},
 }
 
 func init() {
 	rootCmd.AddCommand(generateCmd)
+	generateCmd.Flags().String("at", "", "generate codes for time in RFC3339 format, e.g. 2020-08-31T16:55:02Z")
+	generateCmd.Flags().Duration("offset", 0, "offset added to the time codes are generated for, e.g. -90s or 2m")
+	generateCmd.Flags().String("steps", "", "range of time steps around the time to generate codes for, e.g. -2..2, or N for -N..N")
 }
 
 func generateCmdRun(tokenName string) {
@@ -59,16 +93,101 @@ func generateCmdRun(tokenName string) {
 		fmt.Printf("Error unable to find token: %v\n", err)
 		return
 	}
-	var code string
-	var timeLeft int
+	code, timeLeft, err := generateCode(token)
+	if err != nil {
+		fmt.Printf("Error %v\n", err)
+		return
+	}
+
+	fmt.Printf("code: %v\n", code)
+	if token.IsHotp() {
+		fmt.Printf("counter: %v\n", token.Counter-1)
+	} else {
+		fmt.Printf("timeLeft: %v\n", timeLeft)
+	}
+}
 
-	for ok := true; ok; ok = timeLeft < MinTimeLeft {
-		code, timeLeft = token.GetTotpCode()
-		if !ok && verbose {
-			fmt.Printf("Got code but time left < %d\n", MinTimeLeft)
+func generateTableCmdRun(tokenName, at string, offset time.Duration, steps string) {
+	t := time.Now()
+	if at != "" {
+		var err error
+		t, err = time.Parse(time.RFC3339, at)
+		if err != nil {
+			fmt.Printf("Error invalid time: %s error: %v\n", at, err)
+			return
 		}
 	}
+	t = t.Add(offset)
 
-	fmt.Printf("code: %v\n", code)
-	fmt.Printf("timeLeft: %v\n", timeLeft)
+	from, to, err := parseStepRange(steps)
+	if err != nil {
+		fmt.Printf("Error %v\n", err)
+		return
+	}
+
+	_, tokens, err := Initialize()
+	if err != nil {
+		return
+	}
+
+	token, err := findToken(tokens, tokenName)
+	if err != nil {
+		fmt.Printf("Error unable to find token: %v\n", err)
+		return
+	}
+
+	if token.IsHotp() || token.IsOcra() {
+		fmt.Printf("Error token: %s is not a time based token\n", tokenName)
+		return
+	}
+
+	period := int64(token.GetPeriod())
+	current := totp.GetChallengeAt(t, token.GetPeriod())
+
+	fmt.Printf("time: %s\n\n", t.Format(time.RFC3339))
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(w, "offset\tstep\tcode\tvalid from\tvalid until\n")
+	for i := from; i <= to; i++ {
+		code, err := token.GetTotpCodeForStep(current + i)
+		if err != nil {
+			fmt.Printf("Error %v\n", err)
+			return
+		}
+
+		validFrom := time.Unix((current+i)*period, 0).In(t.Location())
+		validUntil := validFrom.Add(time.Duration(period) * time.Second)
+		fmt.Fprintf(w, "%+d\t%d\t%s\t%s\t%s\n", i, current+i, code, validFrom.Format(time.RFC3339), validUntil.Format(time.RFC3339))
+	}
+	w.Flush()
+}
+
+// parseStepRange parse a step range, FROM..TO or N for -N..N, an empty range is 0..0
+func parseStepRange(steps string) (int64, int64, error) {
+	steps = strings.TrimSpace(steps)
+	if steps == "" {
+		return 0, 0, nil
+	}
+
+	parts := strings.Split(steps, "..")
+	if len(parts) > 2 {
+		return 0, 0, errors.Errorf("invalid step range: %s", steps)
+	}
+
+	from, err := strconv.ParseInt(strings.TrimSpace(parts[0]), 10, 64)
+	if err != nil {
+		return 0, 0, errors.Errorf("invalid step range: %s", steps)
+	}
+
+	if len(parts) == 1 {
+		if from < 0 {
+			from = -from
+		}
+		return -from, from, nil
+	}
+
+	to, err := strconv.ParseInt(strings.TrimSpace(parts[1]), 10, 64)
+	if err != nil || to < from {
+		return 0, 0, errors.Errorf("invalid step range: %s", steps)
+	}
+	return from, to, nil
 }
@@ -0,0 +1,161 @@
+//
+// Copyright © 2020 alexj@backpocket.com
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"fmt"
+	"image"
+	// register decoders for qr code images
+	_ "image/jpeg"
+	_ "image/png"
+	"os"
+	"strings"
+
+	"github.com/alexj212/authy/totp"
+	"github.com/makiuchi-d/gozxing"
+	"github.com/makiuchi-d/gozxing/qrcode"
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+)
+
+// importCmd represents the import command
+var importCmd = &cobra.Command{
+	Use:   "import",
+	Short: "import tokens from qr code images or otpauth uris",
+	Long: `import tokens from qr code images or otpauth uris
+
+Decodes qr codes from png or jpeg images. Both otpauth:// uris and Google Authenticator
+otpauth-migration:// export codes are supported. Imported tokens are saved to the local
+token store, which is kept next to the tokens synced from authy and survives refresh.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		images, err := cmd.Flags().GetStringSlice("qr")
+		if err != nil {
+			cmd.Help()
+			return
+		}
+
+		uris, err := cmd.Flags().GetStringSlice("uri")
+		if err != nil {
+			cmd.Help()
+			return
+		}
+
+		if len(images) == 0 && len(uris) == 0 {
+			cmd.Help()
+			return
+		}
+
+		importCmdRun(images, uris)
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(importCmd)
+	importCmd.Flags().StringSlice("qr", nil, "png or jpeg image containing an otpauth qr code, may be repeated")
+	importCmd.Flags().StringSlice("uri", nil, "otpauth or otpauth-migration uri, may be repeated")
+}
+
+func importCmdRun(images, uris []string) {
+	for _, fname := range images {
+		uri, err := decodeQRImage(fname)
+		if err != nil {
+			fmt.Printf("Error unable to decode qr code: %s error: %v\n", fname, err)
+			return
+		}
+
+		if verbose {
+			fmt.Printf("decoded qr code from: %s\n", fname)
+		}
+		uris = append(uris, uri)
+	}
+
+	var tks []*Token
+	for _, uri := range uris {
+		parsed, err := parseImportURI(uri)
+		if err != nil {
+			fmt.Printf("Error %v\n", err)
+			return
+		}
+		tks = append(tks, parsed...)
+	}
+
+	tokens, err := cachedTokens()
+	if err != nil {
+		fmt.Printf("Error unable to load token cache: %v\n", err)
+		return
+	}
+
+	added, err := addLocalTokens(tokens, tks)
+	if err != nil {
+		fmt.Printf("Error unable to save local tokens: %v\n", err)
+		return
+	}
+
+	for _, v := range added {
+		fmt.Printf("Imported token: %s\n", v.Name)
+	}
+}
+
+// decodeQRImage decode the text of the qr code in a png or jpeg image
+func decodeQRImage(fname string) (string, error) {
+	f, err := os.Open(fname)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	img, _, err := image.Decode(f)
+	if err != nil {
+		return "", err
+	}
+
+	bmp, err := gozxing.NewBinaryBitmapFromImage(img)
+	if err != nil {
+		return "", err
+	}
+
+	result, err := qrcode.NewQRCodeReader().Decode(bmp, nil)
+	if err != nil {
+		return "", err
+	}
+	return result.GetText(), nil
+}
+
+// parseImportURI parse otpauth or otpauth-migration uri into tokens
+func parseImportURI(uri string) ([]*Token, error) {
+	if strings.HasPrefix(strings.ToLower(strings.TrimSpace(uri)), totp.MigrationScheme+":") {
+		keys, err := totp.ParseMigrationURI(uri)
+		if err != nil {
+			return nil, err
+		}
+
+		var tks []*Token
+		for _, k := range keys {
+			tk, err := TokenFromKey(k)
+			if err != nil {
+				return nil, err
+			}
+			tks = append(tks, tk)
+		}
+		return tks, nil
+	}
+
+	tk, err := ParseTokenURI(uri)
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to parse otpauth uri")
+	}
+	return []*Token{tk}, nil
+}
@@ -68,7 +68,10 @@ func listSearch(patternStr string) {
 
 	found := false
 	for _, v := range tokens {
-		if pattern.MatchString(v.Name) {
+		if pattern.MatchString(v.Name) && v.IsLocal() {
+			fmt.Printf("Token: %s (local)\n", v.Name)
+			found = true
+		} else if pattern.MatchString(v.Name) {
 			fmt.Printf("Token: %s\n", v.Name)
 			found = true
 		}
@@ -0,0 +1,192 @@
+//
+// Copyright © 2020 alexj@backpocket.com
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"github.com/pkg/errors"
+)
+
+// localFileName file holding tokens that are not synced from authy
+const localFileName = "local.json"
+
+// IsLocal return true if the token lives in the local token store rather than the authy cache
+func (tk *Token) IsLocal() bool {
+	return tk.Source == TokenSourceLocal
+}
+
+// localFilePurpose authenticated with the encrypted local token store
+const localFilePurpose = "authy local tokens"
+
+// loadLocalTokens load tokens from the local token store, a missing store has no tokens
+func loadLocalTokens() ([]*Token, error) {
+	fpath, err := DataPath(localFileName)
+	if err != nil {
+		return nil, err
+	}
+
+	data, sealed, err := readSealedFile(fpath, localFilePurpose)
+	if os.IsNotExist(err) {
+		return []*Token{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	tokens := []*Token{}
+	err = json.Unmarshal(data, &tokens)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, v := range tokens {
+		v.Source = TokenSourceLocal
+	}
+
+	if verbose {
+		fmt.Printf("Loaded local tokens from %v\n", fpath)
+	}
+
+	if !sealed && !noEncrypt {
+		return updateLocalTokens(func(tks []*Token) ([]*Token, error) { return tks, nil })
+	}
+	return tokens, nil
+}
+
+// updateLocalTokens replace the tokens in the local token store with the tokens update returns, the store is read
+// and written with the lock held. Returns the saved tokens.
+func updateLocalTokens(update func(tks []*Token) ([]*Token, error)) ([]*Token, error) {
+	fpath, err := DataPath(localFileName)
+	if err != nil {
+		return nil, err
+	}
+
+	var tokens []*Token
+	err = updateSealedFile(fpath, localFilePurpose, func(data []byte) ([]byte, error) {
+		tks := []*Token{}
+		if data != nil {
+			decodeErr := json.Unmarshal(data, &tks)
+			if decodeErr != nil {
+				return nil, errors.Wrapf(decodeErr, "unable to read file: %s", fpath)
+			}
+		}
+
+		for _, v := range tks {
+			v.Source = TokenSourceLocal
+		}
+
+		var updateErr error
+		tokens, updateErr = update(tks)
+		if updateErr != nil {
+			return nil, updateErr
+		}
+		return json.Marshal(tokens)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if verbose {
+		fmt.Printf("Saved local tokens to file: %v\n", fpath)
+	}
+	return tokens, nil
+}
+
+// saveLocalTokens save tokens to the local token store
+func saveLocalTokens(tks []*Token) error {
+	fpath, err := DataPath(localFileName)
+	if err != nil {
+		return err
+	}
+
+	data, err := json.Marshal(tks)
+	if err != nil {
+		return err
+	}
+
+	err = writeSealedFile(fpath, localFilePurpose, data)
+	if err != nil {
+		return err
+	}
+
+	if verbose {
+		fmt.Printf("Saved local tokens to file: %v\n", fpath)
+	}
+	return nil
+}
+
+// updateCounter run next with the saved counter of the token and save the counter next leaves. Only the store
+// owning the token is read and written, with the lock held, and only the counter of this token is changed there,
+// so concurrent authy processes never use the same counter nor lose each other's changes.
+func (tk *Token) updateCounter(next func() error) error {
+	apply := func(stored []*Token) error {
+		v, err := findToken(stored, tk.Name)
+		if err != nil {
+			return err
+		}
+
+		if v.Counter > tk.Counter {
+			tk.Counter = v.Counter
+		}
+
+		err = next()
+		if err != nil {
+			return err
+		}
+
+		v.Counter = tk.Counter
+		return nil
+	}
+
+	var err error
+	if tk.IsLocal() {
+		_, err = updateLocalTokens(func(tks []*Token) ([]*Token, error) { return tks, apply(tks) })
+	} else {
+		_, err = updateTokenCache(func(c *tokenCache) error { return apply(c.Tokens) })
+	}
+	return err
+}
+
+// addLocalTokens add tokens to the local token store, tokens with the name of an existing token are skipped.
+// Returns the tokens that were added.
+func addLocalTokens(existing []*Token, tks []*Token) ([]*Token, error) {
+	var added []*Token
+	_, err := updateLocalTokens(func(local []*Token) ([]*Token, error) {
+		added = nil
+		for _, tk := range tks {
+			if _, err := findToken(existing, tk.Name); err == nil {
+				fmt.Printf("token: %s already exists, skipping\n", tk.Name)
+				continue
+			}
+			if _, err := findToken(local, tk.Name); err == nil {
+				fmt.Printf("token: %s already exists, skipping\n", tk.Name)
+				continue
+			}
+
+			tk.Source = TokenSourceLocal
+			local = append(local, tk)
+			added = append(added, tk)
+		}
+		return local, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return added, nil
+}
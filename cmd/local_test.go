@@ -0,0 +1,86 @@
+//
+// Copyright © 2020 alexj@backpocket.com
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import "testing"
+
+func TestUpdateCounter(t *testing.T) {
+	authyHome = t.TempDir()
+	noEncrypt = true
+	defer func() { authyHome, noEncrypt = "", false }()
+
+	_, err := addLocalTokens(nil, []*Token{
+		{Name: "one", Secret: "JBSWY3DPEHPK3PXP", Digital: 6, Type: TokenTypeHotp},
+		{Name: "two", Secret: "JBSWY3DPEHPK3PXP", Digital: 6, Type: TokenTypeHotp},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// two processes loaded the tokens before either advanced a counter
+	first, err := loadLocalTokens()
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := loadLocalTokens()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	codes := map[string]bool{}
+	for _, tk := range []*Token{first[0], second[0], second[1], first[0]} {
+		code, _, err := generateCode(tk)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if tk.Name == "one" {
+			if codes[code] {
+				t.Fatalf("code: %s generated twice for token: %s", code, tk.Name)
+			}
+			codes[code] = true
+		}
+	}
+
+	saved, err := loadLocalTokens()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := map[string]uint64{"one": 3, "two": 1}
+	for _, v := range saved {
+		if v.Counter != expected[v.Name] {
+			t.Errorf("token: %s counter: %d expected: %d", v.Name, v.Counter, expected[v.Name])
+		}
+	}
+}
+
+func TestAddWithoutRegistration(t *testing.T) {
+	authyHome = t.TempDir()
+	noEncrypt = true
+	offline = true
+	defer func() { authyHome, noEncrypt, offline = "", false, false }()
+
+	addCmdRun(&Token{Name: "break-glass", Secret: "JBSWY3DPEHPK3PXP", Digital: 6})
+
+	local, err := loadLocalTokens()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := findToken(local, "break-glass"); err != nil {
+		t.Errorf("token not added without a device registration: %v", err)
+	}
+}
@@ -0,0 +1,80 @@
+//
+// Copyright © 2020 alexj@backpocket.com
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// lockFileName file the advisory lock is taken on, guards read-modify-write cycles of all authy files of all
+// profiles
+const lockFileName = "authy.lock"
+
+var (
+	lockMu    sync.Mutex
+	lockFile  *os.File
+	lockCount int
+)
+
+// lockFiles take the advisory lock shared by all authy processes, blocking until it is available. The lock is
+// reentrant within a process. Call the returned func to release it. Hold it only around a read-modify-write
+// cycle, never across network calls or prompts, which would hold up every other authy process.
+func lockFiles() (func(), error) {
+	lockMu.Lock()
+	defer lockMu.Unlock()
+
+	if lockCount == 0 {
+		fpath, err := configBase.path(defaultProfile, lockFileName)
+		if err != nil {
+			return nil, err
+		}
+
+		err = os.MkdirAll(filepath.Dir(fpath), 0700)
+		if err != nil {
+			return nil, err
+		}
+
+		f, err := os.OpenFile(fpath, os.O_CREATE|os.O_RDWR, 0600)
+		if err != nil {
+			return nil, err
+		}
+
+		err = lockFileHandle(f)
+		if err != nil {
+			f.Close()
+			return nil, err
+		}
+		lockFile = f
+	}
+	lockCount++
+
+	var once sync.Once
+	return func() { once.Do(unlockFiles) }, nil
+}
+
+func unlockFiles() {
+	lockMu.Lock()
+	defer lockMu.Unlock()
+
+	lockCount--
+	if lockCount == 0 {
+		unlockFileHandle(lockFile)
+		lockFile.Close()
+		lockFile = nil
+	}
+}
@@ -0,0 +1,141 @@
+//
+// Copyright © 2020 alexj@backpocket.com
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"net/url"
+	"strings"
+
+	"github.com/alexj212/authy/totp"
+	"github.com/pkg/errors"
+)
+
+const (
+	// originalNameParam otpauth parameter holding Token.OriginalName, which has no standard otpauth equivalent
+	originalNameParam = "original_name"
+	// tokenNameParam otpauth parameter holding Token.Name when it differs from the label, e.g. a token added as
+	// foo with issuer Bar
+	tokenNameParam = "token_name"
+)
+
+// Key return the otpauth key of the token
+func (tk *Token) Key() (*totp.Key, error) {
+	algorithm, err := tk.GetAlgorithm()
+	if err != nil {
+		return nil, err
+	}
+
+	secret, err := tk.GetSecret()
+	if err != nil {
+		return nil, err
+	}
+
+	k := &totp.Key{
+		Type:      totp.KeyTypeTotp,
+		Issuer:    tk.Issuer,
+		Account:   tk.account(),
+		Secret:    secret,
+		Algorithm: algorithm,
+		Digits:    tk.Digital,
+		Period:    tk.Period,
+		Counter:   tk.Counter,
+		Encoding:  tk.GetEncoding(),
+		Suite:     tk.Suite,
+	}
+
+	switch {
+	case tk.IsHotp():
+		k.Type = totp.KeyTypeHotp
+	case tk.IsOcra():
+		k.Type = totp.KeyTypeOcra
+	}
+
+	params := url.Values{}
+	if tk.OriginalName != "" {
+		params.Set(originalNameParam, tk.OriginalName)
+	}
+	if tk.Name != k.Label() {
+		params.Set(tokenNameParam, tk.Name)
+	}
+
+	if len(params) > 0 {
+		k.Params = params
+	}
+	return k, nil
+}
+
+// account return the token name without the "Issuer:" prefix TokenFromKey adds
+func (tk *Token) account() string {
+	if tk.Issuer == "" {
+		return tk.Name
+	}
+	return strings.TrimPrefix(tk.Name, tk.Issuer+":")
+}
+
+// URI return the otpauth uri of the token
+func (tk *Token) URI() (string, error) {
+	k, err := tk.Key()
+	if err != nil {
+		return "", err
+	}
+	return k.URI(), nil
+}
+
+// TokenFromKey create token from otpauth key, the inverse of Token.Key. Keys from other apps name the token
+// "Issuer:Account" so keys of one account at several issuers, common in migration exports, get distinct names.
+func TokenFromKey(k *totp.Key) (*Token, error) {
+	if k.Account == "" {
+		return nil, errors.New("otpauth key has no account name")
+	}
+
+	tk := &Token{
+		Name:    k.Label(),
+		Issuer:  k.Issuer,
+		Digital: k.Digits,
+		Secret:  k.Secret,
+		Period:  k.Period,
+		Counter: k.Counter,
+		Suite:   k.Suite,
+	}
+
+	if k.Algorithm != totp.AlgorithmSHA1 {
+		tk.Algorithm = k.Algorithm.String()
+	}
+
+	switch {
+	case strings.EqualFold(k.Type, totp.KeyTypeHotp):
+		tk.Type = TokenTypeHotp
+	case strings.EqualFold(k.Type, totp.KeyTypeOcra):
+		tk.Type = TokenTypeOcra
+	case k.Encoding == totp.EncodingSteam:
+		tk.Type = TokenTypeSteam
+	}
+
+	if name := k.Params.Get(tokenNameParam); name != "" {
+		tk.Name = name
+	}
+	tk.OriginalName = k.Params.Get(originalNameParam)
+	return tk, nil
+}
+
+// ParseTokenURI create token from otpauth uri
+func ParseTokenURI(uri string) (*Token, error) {
+	k, err := totp.ParseKey(uri)
+	if err != nil {
+		return nil, err
+	}
+	return TokenFromKey(k)
+}
@@ -0,0 +1,94 @@
+//
+// Copyright © 2020 alexj@backpocket.com
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"testing"
+
+	"github.com/alexj212/authy/totp"
+)
+
+func TestTokenFromKeySharedAccount(t *testing.T) {
+	keys := []*totp.Key{
+		{Type: totp.KeyTypeTotp, Issuer: "GitHub", Account: "alice@example.com", Secret: "JBSWY3DPEHPK3PXP"},
+		{Type: totp.KeyTypeTotp, Issuer: "Google", Account: "alice@example.com", Secret: "KRSXG5CTMVRXEZLU"},
+		{Type: totp.KeyTypeTotp, Account: "alice@example.com", Secret: "MZXW6YTBOI"},
+	}
+
+	wantNames := []string{"GitHub:alice@example.com", "Google:alice@example.com", "alice@example.com"}
+	var tks []*Token
+	for i, k := range keys {
+		tk, err := TokenFromKey(k)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if tk.Name != wantNames[i] {
+			t.Errorf("key %d: got name %q want %q", i, tk.Name, wantNames[i])
+		}
+
+		back, err := tk.Key()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if back.Issuer != k.Issuer || back.Account != k.Account {
+			t.Errorf("key %d: round trip got %q %q want %q %q", i, back.Issuer, back.Account, k.Issuer, k.Account)
+		}
+		tks = append(tks, tk)
+	}
+
+	authyHome = t.TempDir()
+	noEncrypt = true
+	defer func() { authyHome, noEncrypt = "", false }()
+
+	added, err := addLocalTokens(nil, tks)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(added) != len(keys) {
+		t.Errorf("added %d tokens want %d", len(added), len(keys))
+	}
+}
+
+func TestTokenKeyRoundTrip(t *testing.T) {
+	tokens := []*Token{
+		{Name: "foo", Issuer: "Bar", Secret: "JBSWY3DPEHPK3PXP", Digital: 6},
+		{Name: "Bar:foo", Issuer: "Bar", Secret: "JBSWY3DPEHPK3PXP", Digital: 6},
+		{Name: "foo", Secret: "JBSWY3DPEHPK3PXP", Digital: 6},
+		{Name: "Bar:foo", Secret: "JBSWY3DPEHPK3PXP", Digital: 6},
+		{Name: "counter", Issuer: "Acme", Secret: "JBSWY3DPEHPK3PXP", Digital: 8, Type: TokenTypeHotp, Counter: 4, OriginalName: "Acme Co"},
+	}
+
+	for _, tk := range tokens {
+		uri, err := tk.URI()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		back, err := ParseTokenURI(uri)
+		if err != nil {
+			t.Fatalf("ParseTokenURI(%q) error: %v", uri, err)
+		}
+
+		// a label with a colon always has an issuer, so only a set issuer is expected back
+		if back.Name != tk.Name || (tk.Issuer != "" && back.Issuer != tk.Issuer) || back.OriginalName != tk.OriginalName || back.Counter != tk.Counter {
+			t.Errorf("%s round trip got name %q issuer %q original name %q counter %d want %q %q %q %d", uri,
+				back.Name, back.Issuer, back.OriginalName, back.Counter, tk.Name, tk.Issuer, tk.OriginalName, tk.Counter)
+		}
+	}
+}
@@ -0,0 +1,185 @@
+//
+// Copyright © 2020 alexj@backpocket.com
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	homedir "github.com/mitchellh/go-homedir"
+)
+
+const (
+	// appDirName directory created under each XDG base directory
+	appDirName = "authy"
+	// homeEnv environment variable overriding the directory all files are kept in, same as --home
+	homeEnv = "AUTHY_HOME"
+)
+
+// authyHome directory all files are kept in when set, from --home or AUTHY_HOME
+var authyHome string
+
+// baseDir XDG base directory authy keeps files in
+type baseDir struct {
+	// env environment variable naming the base directory
+	env string
+	// fallback base directory relative to $HOME when env is not set
+	fallback string
+}
+
+var (
+	configBase = baseDir{"XDG_CONFIG_HOME", ".config"}
+	dataBase   = baseDir{"XDG_DATA_HOME", filepath.Join(".local", "share")}
+	cacheBase  = baseDir{"XDG_CACHE_HOME", ".cache"}
+)
+
+// legacyFile file kept directly in $HOME by earlier versions and where it now lives
+type legacyFile struct {
+	legacyName string
+	base       baseDir
+	name       string
+}
+
+var legacyFiles = []legacyFile{
+	{".authy.json", configBase, configFileName},
+	{".authypassword.json", configBase, passwordFileName},
+	{".authycache.json", cacheBase, cacheFileName},
+	{".authylocal.json", dataBase, localFileName},
+}
+
+// getAuthyHome return the --home or AUTHY_HOME directory, empty when neither is set
+func getAuthyHome() string {
+	if authyHome != "" {
+		return authyHome
+	}
+	return os.Getenv(homeEnv)
+}
+
+// root return the authy directory under the base directory, or the --home directory when set
+func (b baseDir) root() (string, error) {
+	if dir := getAuthyHome(); dir != "" {
+		return dir, nil
+	}
+
+	base := os.Getenv(b.env)
+	if base == "" || !filepath.IsAbs(base) {
+		home, err := homedir.Dir()
+		if err != nil {
+			return "", err
+		}
+		base = filepath.Join(home, b.fallback)
+	}
+	return filepath.Join(base, appDirName), nil
+}
+
+// dir return the directory files of profile are kept in, the root for the default profile. The directory is not
+// created, files are written with writeFileAtomic which creates it.
+func (b baseDir) dir(profile string) (string, error) {
+	dir, err := b.root()
+	if err != nil {
+		return "", err
+	}
+
+	if profile != "" && profile != defaultProfile {
+		dir = filepath.Join(dir, profilesDirName, profile)
+	}
+	return dir, nil
+}
+
+// path return the path of file fname of profile
+func (b baseDir) path(profile, fname string) (string, error) {
+	dir, err := b.dir(profile)
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, fname), nil
+}
+
+// ConfigPath get config file path of the selected profile, $XDG_CONFIG_HOME/authy/fname
+func ConfigPath(fname string) (string, error) {
+	return configBase.path(profileName, fname)
+}
+
+// DataPath get data file path of the selected profile, $XDG_DATA_HOME/authy/fname
+func DataPath(fname string) (string, error) {
+	return dataBase.path(profileName, fname)
+}
+
+// CachePath get cache file path of the selected profile, $XDG_CACHE_HOME/authy/fname
+func CachePath(fname string) (string, error) {
+	return cacheBase.path(profileName, fname)
+}
+
+// migrateLegacyFiles move files kept in $HOME by earlier versions to their XDG locations of the default profile.
+// Files are only moved when the new file does not exist yet, and never when --home or AUTHY_HOME is set.
+func migrateLegacyFiles() error {
+	if getAuthyHome() != "" {
+		return nil
+	}
+
+	home, err := homedir.Dir()
+	if err != nil {
+		return err
+	}
+
+	for _, f := range legacyFiles {
+		legacyPath := filepath.Join(home, f.legacyName)
+		if !fileExists(legacyPath) {
+			continue
+		}
+
+		fpath, err := f.base.path(defaultProfile, f.name)
+		if err != nil {
+			return err
+		}
+
+		if fileExists(fpath) {
+			continue
+		}
+
+		err = moveFile(legacyPath, fpath)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("Moved %s to %s\n", legacyPath, fpath)
+	}
+	return nil
+}
+
+// moveFile rename src to dst, copying when they are on different file systems
+func moveFile(src, dst string) error {
+	err := os.MkdirAll(filepath.Dir(dst), 0700)
+	if err != nil {
+		return err
+	}
+
+	if os.Rename(src, dst) == nil {
+		return nil
+	}
+
+	data, err := ioutil.ReadFile(src)
+	if err != nil {
+		return err
+	}
+
+	err = ioutil.WriteFile(dst, data, 0600)
+	if err != nil {
+		return err
+	}
+	return os.Remove(src)
+}
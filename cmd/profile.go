@@ -0,0 +1,411 @@
+//
+// Copyright © 2020 alexj@backpocket.com
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+)
+
+const (
+	// defaultProfile profile whose files are kept directly in the authy directories
+	defaultProfile = "default"
+	// profilesDirName directory under each authy directory holding a directory per named profile
+	profilesDirName = "profiles"
+	// profileEnv environment variable selecting the profile, same as --profile
+	profileEnv = "AUTHY_PROFILE"
+	// profileConfigFileName file in the config directory recording the default profile
+	profileConfigFileName = "profiles.json"
+)
+
+// profileName profile selected with --profile, AUTHY_PROFILE or authy profile default
+var profileName string
+
+var validProfileName = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9_.-]*$`)
+
+// profileConfig profile settings shared by all profiles
+type profileConfig struct {
+	Default string `json:"default,omitempty"`
+}
+
+// profileCmd represents the profile command
+var profileCmd = &cobra.Command{
+	Use:   "profile",
+	Short: "manage profiles for multiple authy accounts",
+	Long: `manage profiles for multiple authy accounts
+
+Each profile has its own device registration, token cache and local tokens. Select a profile with
+--profile NAME or $AUTHY_PROFILE, otherwise the profile set with "authy profile default" is used.
+A named profile must be added with "authy profile add" before it can be selected.`,
+	// profile commands take the profile as an argument, the selected profile need not exist
+	PersistentPreRun: func(cmd *cobra.Command, args []string) {},
+}
+
+var profileListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "list profiles, * marks the default profile",
+	Run: func(cmd *cobra.Command, args []string) {
+		profileListCmdRun()
+	},
+}
+
+var profileAddCmd = &cobra.Command{
+	Use:   "add [ProfileName]",
+	Short: "add a profile and register it as a new authy device",
+	Run: func(cmd *cobra.Command, args []string) {
+		if len(args) != 1 {
+			cmd.Help()
+			return
+		}
+
+		profileAddCmdRun(args[0])
+	},
+}
+
+var profileRemoveCmd = &cobra.Command{
+	Use:   "remove [ProfileName]",
+	Short: "remove a profile and all of its files",
+	Run: func(cmd *cobra.Command, args []string) {
+		if len(args) != 1 {
+			cmd.Help()
+			return
+		}
+
+		yes, err := cmd.Flags().GetBool("yes")
+		if err != nil {
+			cmd.Help()
+			return
+		}
+
+		profileRemoveCmdRun(args[0], yes)
+	},
+}
+
+var profileDefaultCmd = &cobra.Command{
+	Use:   "default [ProfileName]",
+	Short: "show or set the profile used when none is selected",
+	Run: func(cmd *cobra.Command, args []string) {
+		if len(args) > 1 {
+			cmd.Help()
+			return
+		}
+
+		profileDefaultCmdRun(args)
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(profileCmd)
+	profileCmd.AddCommand(profileListCmd)
+	profileCmd.AddCommand(profileAddCmd)
+	profileCmd.AddCommand(profileRemoveCmd)
+	profileCmd.AddCommand(profileDefaultCmd)
+	profileRemoveCmd.Flags().BoolP("yes", "y", false, "do not ask for confirmation before removing the profile")
+}
+
+// checkProfileName return an error if name can not be used as a profile directory name
+func checkProfileName(name string) error {
+	if !validProfileName.MatchString(name) {
+		return errors.Errorf("invalid profile name: %q, use letters, digits, '.', '_' and '-'", name)
+	}
+	return nil
+}
+
+// selectProfile select the profile from --profile, else AUTHY_PROFILE, else the configured default profile
+func selectProfile() error {
+	if profileName == "" {
+		profileName = os.Getenv(profileEnv)
+	}
+
+	if profileName == "" {
+		cfg, err := loadProfileConfig()
+		if err != nil {
+			return err
+		}
+		profileName = cfg.Default
+	}
+
+	if profileName == "" {
+		profileName = defaultProfile
+	}
+	return checkProfileName(profileName)
+}
+
+// checkSelectedProfile return an error if the selected profile is a named profile without a device registration,
+// so a mistyped --profile never registers a new device
+func checkSelectedProfile() error {
+	if profileName == defaultProfile {
+		return nil
+	}
+
+	registered, err := profileExists(profileName)
+	if err != nil {
+		return err
+	}
+
+	if !registered {
+		return errors.Errorf("unable to find profile: %s, add it with authy profile add %s", profileName, profileName)
+	}
+	return nil
+}
+
+func loadProfileConfig() (*profileConfig, error) {
+	fpath, err := configBase.path(defaultProfile, profileConfigFileName)
+	if err != nil {
+		return nil, err
+	}
+
+	cfg := &profileConfig{}
+	data, err := ioutil.ReadFile(fpath)
+	if os.IsNotExist(err) {
+		return cfg, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	err = json.Unmarshal(data, cfg)
+	if err != nil {
+		return nil, errors.Wrapf(err, "unable to read file: %s", fpath)
+	}
+	return cfg, nil
+}
+
+func saveProfileConfig(cfg *profileConfig) error {
+	fpath, err := configBase.path(defaultProfile, profileConfigFileName)
+	if err != nil {
+		return err
+	}
+
+	data, err := json.Marshal(cfg)
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(fpath, append(data, '\n'), 0600)
+}
+
+// listProfiles return the default profile followed by the named profiles
+func listProfiles() ([]string, error) {
+	root, err := configBase.root()
+	if err != nil {
+		return nil, err
+	}
+
+	profiles := []string{defaultProfile}
+	entries, err := ioutil.ReadDir(filepath.Join(root, profilesDirName))
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+
+	for _, v := range entries {
+		if v.IsDir() && checkProfileName(v.Name()) == nil {
+			profiles = append(profiles, v.Name())
+		}
+	}
+	return profiles, nil
+}
+
+// profileExists return true if profile has a device registration
+func profileExists(profile string) (bool, error) {
+	fpath, err := configBase.path(profile, configFileName)
+	if err != nil {
+		return false, err
+	}
+	return fileExists(fpath), nil
+}
+
+func profileListCmdRun() {
+	cfg, err := loadProfileConfig()
+	if err != nil {
+		fmt.Printf("Error %v\n", err)
+		return
+	}
+
+	profiles, err := listProfiles()
+	if err != nil {
+		fmt.Printf("Error unable to list profiles: %v\n", err)
+		return
+	}
+
+	for _, v := range profiles {
+		mark := " "
+		if v == cfg.Default || (cfg.Default == "" && v == defaultProfile) {
+			mark = "*"
+		}
+
+		registered, err := profileExists(v)
+		if err != nil {
+			fmt.Printf("Error %v\n", err)
+			return
+		}
+
+		status := ""
+		if !registered {
+			status = " (not registered)"
+		}
+		fmt.Printf("%s %s%s\n", mark, v, status)
+	}
+}
+
+func profileAddCmdRun(name string) {
+	err := checkProfileName(name)
+	if err != nil {
+		fmt.Printf("Error %v\n", err)
+		return
+	}
+
+	registered, err := profileExists(name)
+	if err != nil {
+		fmt.Printf("Error %v\n", err)
+		return
+	}
+
+	if registered {
+		fmt.Printf("Error profile: %s already exists\n", name)
+		return
+	}
+
+	profileName = name
+	_, _, err = Initialize()
+	if err != nil {
+		return
+	}
+	fmt.Printf("Added profile: %s, use it with --profile %s\n", name, name)
+}
+
+func profileRemoveCmdRun(name string, yes bool) {
+	if name == defaultProfile {
+		fmt.Printf("Error the %s profile can not be removed, use wipe to remove its files\n", defaultProfile)
+		return
+	}
+
+	profiles, err := listProfiles()
+	if err != nil {
+		fmt.Printf("Error unable to list profiles: %v\n", err)
+		return
+	}
+
+	if !containsString(profiles, name) {
+		fmt.Printf("Error unable to find profile: %s\n", name)
+		return
+	}
+
+	if !yes && !confirm(fmt.Sprintf("Remove profile %s, its device registration and tokens?", name)) {
+		return
+	}
+
+	unlock, err := lockFiles()
+	if err != nil {
+		fmt.Printf("Error locking authy files: %v\n", err)
+		return
+	}
+	defer unlock()
+
+	for _, base := range []baseDir{configBase, dataBase, cacheBase} {
+		dir, err := base.dir(name)
+		if err != nil {
+			fmt.Printf("Error %v\n", err)
+			return
+		}
+
+		err = os.RemoveAll(dir)
+		if err != nil {
+			fmt.Printf("Error unable to remove profile directory: %s error: %v\n", dir, err)
+			return
+		}
+	}
+
+	cfg, err := loadProfileConfig()
+	if err != nil {
+		fmt.Printf("Error %v\n", err)
+		return
+	}
+
+	if cfg.Default == name {
+		cfg.Default = ""
+		err = saveProfileConfig(cfg)
+		if err != nil {
+			fmt.Printf("Error unable to reset default profile: %v\n", err)
+			return
+		}
+		fmt.Printf("Default profile reset to: %s\n", defaultProfile)
+	}
+	fmt.Printf("Removed profile: %s\n", name)
+}
+
+func profileDefaultCmdRun(args []string) {
+	unlock, err := lockFiles()
+	if err != nil {
+		fmt.Printf("Error locking authy files: %v\n", err)
+		return
+	}
+	defer unlock()
+
+	cfg, err := loadProfileConfig()
+	if err != nil {
+		fmt.Printf("Error %v\n", err)
+		return
+	}
+
+	if len(args) == 0 {
+		if cfg.Default == "" {
+			fmt.Println(defaultProfile)
+		} else {
+			fmt.Println(cfg.Default)
+		}
+		return
+	}
+
+	name := args[0]
+	profiles, err := listProfiles()
+	if err != nil {
+		fmt.Printf("Error unable to list profiles: %v\n", err)
+		return
+	}
+
+	if !containsString(profiles, name) {
+		fmt.Printf("Error unable to find profile: %s, add it with authy profile add %s\n", name, name)
+		return
+	}
+
+	cfg.Default = name
+	if name == defaultProfile {
+		cfg.Default = ""
+	}
+
+	err = saveProfileConfig(cfg)
+	if err != nil {
+		fmt.Printf("Error unable to save default profile: %v\n", err)
+		return
+	}
+	fmt.Printf("Default profile: %s\n", name)
+}
+
+func containsString(values []string, s string) bool {
+	for _, v := range values {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,117 @@
+//
+// Copyright © 2020 alexj@backpocket.com
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"fmt"
+	"io/ioutil"
+
+	"github.com/skip2/go-qrcode"
+	"github.com/spf13/cobra"
+)
+
+// qrCmd represents the qr command
+var qrCmd = &cobra.Command{
+	Use:   "qr [TokenName]",
+	Short: "display token as an otpauth qr code",
+	Long: `display token as an otpauth qr code
+
+Draws the otpauth uri of the token as a qr code in the terminal, or writes it to a png file.
+The qr code contains the token secret, you will be asked to confirm unless --yes is given.`,
+	Run: func(cmd *cobra.Command, args []string) {
+
+		if len(args) != 1 {
+			cmd.Help()
+			return
+		}
+
+		pngFile, err := cmd.Flags().GetString("png")
+		if err != nil {
+			cmd.Help()
+			return
+		}
+
+		size, err := cmd.Flags().GetInt("size")
+		if err != nil {
+			cmd.Help()
+			return
+		}
+
+		yes, err := cmd.Flags().GetBool("yes")
+		if err != nil {
+			cmd.Help()
+			return
+		}
+
+		qrCmdRun(args[0], pngFile, size, yes)
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(qrCmd)
+	qrCmd.Flags().String("png", "", "write qr code to png file instead of the terminal")
+	qrCmd.Flags().Int("size", 256, "width and height of png file in pixels")
+	qrCmd.Flags().BoolP("yes", "y", false, "do not ask for confirmation before showing the secret")
+}
+
+func qrCmdRun(tokenName, pngFile string, size int, yes bool) {
+	_, tokens, err := Initialize()
+	if err != nil {
+		return
+	}
+
+	token, err := findToken(tokens, tokenName)
+	if err != nil {
+		fmt.Printf("Error unable to find token: %v\n", err)
+		return
+	}
+
+	uri, err := token.URI()
+	if err != nil {
+		fmt.Printf("Error %v\n", err)
+		return
+	}
+
+	if !yes && !confirm(fmt.Sprintf("The qr code contains the secret of token: %s. Show it?", tokenName)) {
+		fmt.Printf("cancelled\n")
+		return
+	}
+
+	qr, err := qrcode.New(uri, qrcode.Medium)
+	if err != nil {
+		fmt.Printf("Error unable to create qr code: %v\n", err)
+		return
+	}
+
+	if pngFile == "" {
+		fmt.Print(qr.ToSmallString(false))
+		return
+	}
+
+	png, err := qr.PNG(size)
+	if err != nil {
+		fmt.Printf("Error unable to create png: %v\n", err)
+		return
+	}
+
+	err = ioutil.WriteFile(pngFile, png, 0600)
+	if err != nil {
+		fmt.Printf("Error unable to write png file: %s error: %v\n", pngFile, err)
+		return
+	}
+
+	fmt.Printf("wrote qr code to: %s\n", pngFile)
+}
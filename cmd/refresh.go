@@ -29,12 +29,15 @@ var refreshCmd = &cobra.Command{
 
 You can use this cmd to refresh local token cache`,
 	Run: func(cmd *cobra.Command, args []string) {
-		devInfo, _, err := Initialize()
-		if err != nil {
-			log.Fatal("Load device info failed", err)
+		if offline {
+			log.Fatal("Refresh is not possible while offline")
 		}
 
-		getTokensFromAuthyServer(devInfo)
+		refreshCache = true
+		_, _, err := Initialize()
+		if err != nil {
+			log.Fatal("Refresh token cache failed", err)
+		}
 	},
 }
 
@@ -0,0 +1,95 @@
+//
+// Copyright © 2020 alexj@backpocket.com
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+)
+
+// removeCmd represents the remove command
+var removeCmd = &cobra.Command{
+	Use:   "remove [TokenName]",
+	Short: "remove a token from the local token store",
+	Long: `remove a token from the local token store
+
+Only tokens added with add or import can be removed, tokens synced from authy are managed in the authy app.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		if len(args) != 1 {
+			cmd.Help()
+			return
+		}
+
+		yes, err := cmd.Flags().GetBool("yes")
+		if err != nil {
+			cmd.Help()
+			return
+		}
+
+		removeCmdRun(args[0], yes)
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(removeCmd)
+	removeCmd.Flags().BoolP("yes", "y", false, "do not ask for confirmation before removing the token")
+}
+
+func removeCmdRun(tokenName string, yes bool) {
+	local, err := loadLocalTokens()
+	if err != nil {
+		fmt.Printf("Error unable to load local tokens: %v\n", err)
+		return
+	}
+
+	if _, err := findToken(local, tokenName); err != nil {
+		if c, err := loadTokenCache(); err == nil {
+			if _, err := findToken(c.Tokens, tokenName); err == nil {
+				fmt.Printf("Error token: %s is synced from authy, remove it in the authy app\n", tokenName)
+				return
+			}
+		}
+
+		fmt.Printf("Error unable to find local token: %s\n", tokenName)
+		return
+	}
+
+	if !yes && !confirm(fmt.Sprintf("Remove local token: %s? Its secret can not be recovered.", tokenName)) {
+		fmt.Printf("cancelled\n")
+		return
+	}
+
+	_, err = updateLocalTokens(func(tks []*Token) ([]*Token, error) {
+		if _, err := findToken(tks, tokenName); err != nil {
+			return nil, errors.Errorf("unable to find local token: %s", tokenName)
+		}
+
+		kept := []*Token{}
+		for _, v := range tks {
+			if v.Name != tokenName {
+				kept = append(kept, v)
+			}
+		}
+		return kept, nil
+	})
+	if err != nil {
+		fmt.Printf("Error unable to save local tokens: %v\n", err)
+		return
+	}
+	fmt.Printf("Removed local token: %s\n", tokenName)
+}
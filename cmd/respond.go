@@ -0,0 +1,142 @@
+//
+// Copyright © 2020 alexj@backpocket.com
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"encoding/hex"
+	"fmt"
+	"time"
+
+	"github.com/alexj212/authy/totp"
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+)
+
+// respondCmd represents the respond command
+var respondCmd = &cobra.Command{
+	Use:   "respond [TokenName] [CHALLENGE]",
+	Short: "generate an ocra response to a challenge",
+	Long: `generate an ocra (RFC 6287) response to a challenge
+
+The token must be an ocra token with an ocra suite, e.g. OCRA-1:HOTP-SHA1-6:QN08-PSHA1.
+The counter of suites using a counter is advanced and saved after each response.
+Suites using a pin hash prompt for the pin.`,
+	Run: func(cmd *cobra.Command, args []string) {
+
+		if len(args) != 2 {
+			cmd.Help()
+			return
+		}
+
+		session, err := cmd.Flags().GetString("session")
+		if err != nil {
+			cmd.Help()
+			return
+		}
+
+		respondCmdRun(args[0], args[1], session)
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(respondCmd)
+	respondCmd.Flags().StringP("session", "s", "", "session information as hex for suites using session information")
+}
+
+func respondCmdRun(tokenName, challenge, session string) {
+	_, tokens, err := Initialize()
+	if err != nil {
+		return
+	}
+
+	token, err := findToken(tokens, tokenName)
+	if err != nil {
+		fmt.Printf("Error unable to find token: %v\n", err)
+		return
+	}
+
+	response, err := generateOcraResponse(token, challenge, session)
+	if err != nil {
+		fmt.Printf("Error %v\n", err)
+		return
+	}
+
+	fmt.Printf("response: %v\n", response)
+}
+
+// generateOcraResponse compute response to challenge for an ocra token, counter based suites have the counter
+// advanced and saved to the store owning the token before the response is returned. The pin of suites using a
+// pin hash is prompted for, so it never shows up in the process list or shell history.
+func generateOcraResponse(tk *Token, challenge, session string) (string, error) {
+	if !tk.IsOcra() {
+		return "", errors.Errorf("token: %s is not an ocra token", tk.Name)
+	}
+
+	suite, err := totp.ParseOCRASuite(tk.Suite)
+	if err != nil {
+		return "", errors.Wrapf(err, "invalid ocra suite for token: %s", tk.Name)
+	}
+
+	var pin string
+	if suite.PIN {
+		pp, err := readPassword(fmt.Sprintf("\nPlease input pin for token %s: ", tk.Name))
+		if err != nil {
+			return "", err
+		}
+
+		if len(pp) == 0 {
+			return "", errors.Errorf("ocra suite %s requires a pin", suite.Suite)
+		}
+		pin = string(pp)
+	}
+
+	sessionInfo, err := hex.DecodeString(session)
+	if err != nil {
+		return "", errors.Wrap(err, "invalid session information")
+	}
+
+	key, err := totp.DefaultNewBase32Decode().DecodeLenient(tk.Secret)
+	if err != nil {
+		return "", errors.Wrapf(err, "invalid secret for token: %s", tk.Name)
+	}
+
+	compute := func() (string, error) {
+		return suite.Compute(key, totp.OCRAInput{
+			Counter:   tk.Counter,
+			Challenge: challenge,
+			PIN:       pin,
+			Session:   sessionInfo,
+			Time:      time.Now(),
+		})
+	}
+
+	if !suite.Counter {
+		return compute()
+	}
+
+	var response string
+	err = tk.updateCounter(func() (err error) {
+		response, err = compute()
+		if err == nil {
+			tk.Counter++
+		}
+		return err
+	})
+	if err != nil {
+		return "", errors.Wrapf(err, "unable to advance counter for token: %s", tk.Name)
+	}
+	return response, nil
+}
@@ -0,0 +1,184 @@
+//
+// Copyright © 2020 alexj@backpocket.com
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+)
+
+// restoreCmd represents the restore command
+var restoreCmd = &cobra.Command{
+	Use:   "restore [BackupFile]",
+	Short: "restore the device registration and tokens from a backup",
+	Long: `restore the device registration and tokens from a backup
+
+Reinstates the device registration, token cache and local tokens written by backup into the selected profile.
+A named profile that does not exist yet is created, without registering a new device.
+Use --dry-run to list what would change without restoring anything.`,
+	// restore creates the device registration of the selected profile, it need not exist
+	PersistentPreRun: func(cmd *cobra.Command, args []string) {},
+	Run: func(cmd *cobra.Command, args []string) {
+		if len(args) != 1 {
+			cmd.Help()
+			return
+		}
+
+		dryRun, err := cmd.Flags().GetBool("dry-run")
+		if err != nil {
+			cmd.Help()
+			return
+		}
+
+		yes, err := cmd.Flags().GetBool("yes")
+		if err != nil {
+			cmd.Help()
+			return
+		}
+
+		restoreCmdRun(args[0], dryRun, yes)
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(restoreCmd)
+	restoreCmd.Flags().BoolP("dry-run", "n", false, "list what would change without restoring anything")
+	restoreCmd.Flags().BoolP("yes", "y", false, "do not ask for confirmation before replacing existing files")
+}
+
+// printDeviceChange print how the device registration changes, returns true if an existing one is replaced
+func printDeviceChange(current, restored *DeviceRegistration) bool {
+	switch {
+	case current == nil:
+		fmt.Printf("device registration: new, user: %d device: %d\n", restored.UserID, restored.DeviceID)
+		return false
+	case *current == *restored:
+		fmt.Printf("device registration: unchanged\n")
+		return false
+	default:
+		fmt.Printf("device registration: replaced, user: %d device: %d -> user: %d device: %d\n",
+			current.UserID, current.DeviceID, restored.UserID, restored.DeviceID)
+		return true
+	}
+}
+
+// printTokenChanges print tokens added (+), removed (-) and changed (~) by replacing current with restored,
+// returns true if tokens are removed or changed
+func printTokenChanges(kind string, current, restored []*Token) bool {
+	fmt.Printf("%s tokens: %d -> %d\n", kind, len(current), len(restored))
+
+	replaced := false
+	for _, v := range restored {
+		tk, err := findToken(current, v.Name)
+		if err != nil {
+			fmt.Printf("  + %s\n", v.Name)
+		} else if *tk != *v {
+			fmt.Printf("  ~ %s\n", v.Name)
+			replaced = true
+		}
+	}
+
+	for _, v := range current {
+		if _, err := findToken(restored, v.Name); err != nil {
+			fmt.Printf("  - %s\n", v.Name)
+			replaced = true
+		}
+	}
+	return replaced
+}
+
+func restoreCmdRun(fpath string, dryRun, yes bool) {
+	a, err := readBackupArchive(fpath)
+	if err != nil {
+		fmt.Printf("Error %v\n", err)
+		return
+	}
+
+	devInfo, err := LoadExistingDeviceInfo()
+	if err != nil && !os.IsNotExist(err) {
+		fmt.Printf("Error %v\n", err)
+		return
+	}
+
+	var synced []*Token
+	c, err := loadTokenCache()
+	if err != nil && !os.IsNotExist(errors.Cause(err)) {
+		fmt.Printf("Error %v\n", err)
+		return
+	}
+	if err == nil {
+		synced = c.Tokens
+	}
+
+	local, err := loadLocalTokens()
+	if err != nil {
+		fmt.Printf("Error %v\n", err)
+		return
+	}
+
+	fmt.Printf("backup of profile: %s created: %s restoring to profile: %s\n", a.Profile, a.CreatedAt.Local().Format(time.RFC3339), profileName)
+	replaced := printDeviceChange(devInfo, a.Device)
+	if a.Cache != nil {
+		replaced = printTokenChanges("synced", synced, a.Cache.Tokens) || replaced
+	}
+	replaced = printTokenChanges("local", local, a.Local) || replaced
+
+	if dryRun {
+		fmt.Printf("dry run, nothing restored\n")
+		return
+	}
+
+	if replaced && !yes && !confirm("Replace the existing files?") {
+		fmt.Printf("cancelled\n")
+		return
+	}
+
+	unlock, err := lockFiles()
+	if err != nil {
+		fmt.Printf("Error locking authy files: %v\n", err)
+		return
+	}
+	defer unlock()
+
+	err = SaveDeviceInfo(a.Device)
+	if err != nil {
+		fmt.Printf("Error unable to save device info: %v\n", err)
+		return
+	}
+
+	if a.Cache != nil {
+		err = a.Cache.save()
+		if err != nil {
+			fmt.Printf("Error unable to save token cache: %v\n", err)
+			return
+		}
+	}
+
+	for _, v := range a.Local {
+		v.Source = TokenSourceLocal
+	}
+
+	err = saveLocalTokens(a.Local)
+	if err != nil {
+		fmt.Printf("Error unable to save local tokens: %v\n", err)
+		return
+	}
+	fmt.Printf("restored backup: %s\n", fpath)
+}
@@ -0,0 +1,72 @@
+//
+// Copyright © 2020 alexj@backpocket.com
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func TestRestoreNewProfile(t *testing.T) {
+	home := t.TempDir()
+	authyHome = home
+	profileName = defaultProfile
+	passphrase = []byte("passphrase")
+	defer func() { authyHome, profileName, passphrase = "", "", nil }()
+
+	err := SaveDeviceInfo(&DeviceRegistration{UserID: 1, DeviceID: 2, Seed: "seed"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = addLocalTokens(nil, []*Token{{Name: "fixture", Secret: "JBSWY3DPEHPK3PXP", Digital: 6}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	out := filepath.Join(t.TempDir(), "backup.json")
+	backupCmdRun(out)
+
+	rootCmd.SetArgs([]string{"--home", home, "--profile", "work", "restore", "--yes", out})
+	err = rootCmd.Execute()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if profileName != "work" {
+		t.Fatalf("restored to profile: %s expected work", profileName)
+	}
+
+	devInfo, err := LoadExistingDeviceInfo()
+	if err != nil {
+		t.Fatalf("restored profile has no device registration: %v", err)
+	}
+	if devInfo.UserID != 1 || devInfo.DeviceID != 2 {
+		t.Errorf("restored device user id: %d device id: %d expected 1 2", devInfo.UserID, devInfo.DeviceID)
+	}
+
+	local, err := loadLocalTokens()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := findToken(local, "fixture"); err != nil {
+		t.Error(err)
+	}
+
+	if err := checkSelectedProfile(); err != nil {
+		t.Errorf("restored profile can not be selected: %v", err)
+	}
+}
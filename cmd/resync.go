@@ -0,0 +1,98 @@
+//
+// Copyright © 2020 alexj@backpocket.com
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/alexj212/authy/totp"
+	"github.com/spf13/cobra"
+)
+
+// resyncCmd represents the resync command
+var resyncCmd = &cobra.Command{
+	Use:   "resync [TokenName] [CODE]...",
+	Short: "resync the counter of a hotp token",
+	Long: `resync the counter of a hotp token
+
+Searches ahead of the saved counter for the supplied code(s) read from the token.
+When more than one code is supplied they must be consecutive codes.
+The counter is saved so the next generated code follows the last supplied code.`,
+	Run: func(cmd *cobra.Command, args []string) {
+
+		if len(args) < 2 {
+			cmd.Help()
+			return
+		}
+
+		lookAhead, err := cmd.Flags().GetInt("look-ahead")
+		if err != nil {
+			cmd.Help()
+			return
+		}
+
+		resyncCmdRun(args[0], args[1:], lookAhead)
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(resyncCmd)
+	resyncCmd.Flags().IntP("look-ahead", "l", totp.DefaultResyncLookAhead, "number of counter values to search past the saved counter")
+}
+
+func resyncCmdRun(tokenName string, codes []string, lookAhead int) {
+	_, tokens, err := Initialize()
+	if err != nil {
+		return
+	}
+
+	token, err := findToken(tokens, tokenName)
+	if err != nil {
+		fmt.Printf("Error unable to find token: %v\n", err)
+		return
+	}
+
+	if !token.IsHotp() {
+		fmt.Printf("Error token: %s is not a hotp token\n", tokenName)
+		return
+	}
+
+	algorithm, err := token.GetAlgorithm()
+	if err != nil {
+		fmt.Printf("Error %v\n", err)
+		return
+	}
+
+	secret, err := token.GetSecret()
+	if err != nil {
+		fmt.Printf("Error %v\n", err)
+		return
+	}
+
+	err = token.updateCounter(func() error {
+		counter, err := totp.ResyncHotp(secret, codes, token.Counter, lookAhead, token.Digital, algorithm)
+		if err != nil {
+			return err
+		}
+
+		fmt.Printf("counter: %d -> %d\n", token.Counter, counter)
+		token.Counter = counter
+		return nil
+	})
+	if err != nil {
+		fmt.Printf("Error %v\n", err)
+	}
+}
@@ -35,6 +35,13 @@ var rootCmd = &cobra.Command{
 	// Uncomment the following line if your bare application
 	// has an action associated with it:
 	//	Run: func(cmd *cobra.Command, args []string) { },
+
+	PersistentPreRun: func(cmd *cobra.Command, args []string) {
+		if err := checkSelectedProfile(); err != nil {
+			fmt.Printf("Error %v\n", err)
+			os.Exit(1)
+		}
+	},
 }
 
 // Execute adds all child commands to the root command and sets flags appropriately.
@@ -53,6 +60,11 @@ func init() {
 	// Cobra supports persistent flags, which, if defined here,
 	// will be global for your application.
 	rootCmd.PersistentFlags().BoolVarP(&verbose, "verbose", "v", false, "verbose output")
+	rootCmd.PersistentFlags().StringVar(&profileName, "profile", "", "profile to use, for multiple authy accounts ($AUTHY_PROFILE)")
+	rootCmd.PersistentFlags().StringVar(&authyHome, "home", "", "directory to keep all authy files in, instead of the XDG config, data and cache directories ($AUTHY_HOME)")
+	rootCmd.PersistentFlags().DurationVar(&maxCacheAge, "max-cache-age", defaultMaxCacheAge, "refresh the token cache from authy when it is older than this, 0 never refreshes ($AUTHY_MAX_CACHE_AGE)")
+	rootCmd.PersistentFlags().BoolVar(&offline, "offline", false, "never contact the authy server, use the token cache however old it is")
+	rootCmd.PersistentFlags().BoolVar(&noEncrypt, "no-encrypt", false, "write token files in plaintext instead of encrypting them with a passphrase ($AUTHY_PASSPHRASE or prompt)")
 }
 
 // initConfig reads in config file and ENV variables if set.
@@ -73,6 +85,15 @@ func initConfig() {
 		viper.SetConfigName(".cobra")
 	}
 
+	if err := migrateLegacyFiles(); err != nil {
+		fmt.Printf("Error moving legacy files, error: %v\n", err)
+	}
+
+	if err := selectProfile(); err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+
 	viper.AutomaticEnv() // read in environment variables that match
 
 	// If a config file is found, read it in.
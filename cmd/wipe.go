@@ -24,10 +24,12 @@ import (
 // wipeCmd represents the wipe command
 var wipeCmd = &cobra.Command{
 	Use:   "wipe",
-	Short: "remove ~/.authy*.json cache files",
-	Long: `Remove authy cache files
-.authy.json
-.authycache.json
+	Short: "remove authy config, password and cache files",
+	Long: `Remove authy config and cache files
+$XDG_CONFIG_HOME/authy/authy.json
+$XDG_CONFIG_HOME/authy/password.json
+$XDG_CACHE_HOME/authy/cache.json
+and the .bak copies of their previous versions
 
 `,
 	Run: func(cmd *cobra.Command, args []string) {
@@ -40,6 +42,12 @@ func init() {
 }
 
 func wipeExec(cmd *cobra.Command, args []string) {
+	unlock, err := lockFiles()
+	if err != nil {
+		fmt.Printf("unable to lock authy files: %v\n", err)
+		return
+	}
+	defer unlock()
 
 	fpath, err := ConfigPath(configFileName)
 	if err != nil {
@@ -47,30 +55,46 @@ func wipeExec(cmd *cobra.Command, args []string) {
 		return
 	}
 
-	if fileExists(fpath) {
-		err = os.Remove(fpath)
-		if err != nil {
-			fmt.Printf("unable to delete config file: %s error: %v\n", fpath, err)
-			return
-		}
+	if !removeFiles("config", fpath, fpath+backupSuffix) {
+		return
+	}
+
+	fpath, err = ConfigPath(passwordFileName)
+	if err != nil {
+		fmt.Printf("unable to get password file: %s error: %v\n", passwordFileName, err)
+		return
+	}
 
-		fmt.Printf("deleted config file: %s\n", fpath)
+	if !removeFiles("password", fpath, fpath+backupSuffix) {
+		return
 	}
 
-	fpath, err = ConfigPath(cacheFileName)
+	fpath, err = CachePath(cacheFileName)
 	if err != nil {
 		fmt.Printf("unable to get cache file: %s error: %v\n", cacheFileName, err)
 		return
 	}
 
-	if fileExists(fpath) {
-		err = os.Remove(fpath)
+	if !removeFiles("cache", fpath, fpath+backupSuffix) {
+		return
+	}
+
+	fmt.Printf("Removed config, password & cache files\n")
+}
+
+// removeFiles delete each existing file in fpaths, returns false if one could not be deleted
+func removeFiles(kind string, fpaths ...string) bool {
+	for _, fpath := range fpaths {
+		if !fileExists(fpath) {
+			continue
+		}
+
+		err := os.Remove(fpath)
 		if err != nil {
-			fmt.Printf("unable to delete cache file: %s error: %v\n", fpath, err)
-			return
+			fmt.Printf("unable to delete %s file: %s error: %v\n", kind, fpath, err)
+			return false
 		}
-		fmt.Printf("deleted cache file: %s\n", fpath)
+		fmt.Printf("deleted %s file: %s\n", kind, fpath)
 	}
-
-	fmt.Printf("Removed config & cache files\n")
+	return true
 }
@@ -4,8 +4,10 @@ go 1.15
 
 require (
 	github.com/alexzorin/authy v0.2.0
+	github.com/makiuchi-d/gozxing v0.1.1
 	github.com/mitchellh/go-homedir v1.1.0
 	github.com/pkg/errors v0.8.1
+	github.com/skip2/go-qrcode v0.0.0-20200617195104-da1b6568686e
 	github.com/spf13/cobra v1.0.0
 	github.com/spf13/viper v1.7.1
 	golang.org/x/crypto v0.0.0-20200820211705-5c72a883971a
@@ -0,0 +1,75 @@
+//
+// Copyright © 2020 alexj@backpocket.com
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package totp
+
+import (
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"fmt"
+	"hash"
+	"strings"
+)
+
+// Algorithm hmac hash algorithm used to generate codes (RFC 6238 section 1.2)
+type Algorithm int
+
+const (
+	// AlgorithmSHA1 HMAC-SHA1, the default
+	AlgorithmSHA1 Algorithm = iota
+	// AlgorithmSHA256 HMAC-SHA256
+	AlgorithmSHA256
+	// AlgorithmSHA512 HMAC-SHA512
+	AlgorithmSHA512
+)
+
+// ParseAlgorithm parse algorithm name as used in otpauth uris (SHA1, SHA256, SHA512), case-insensitive.
+// An empty name returns AlgorithmSHA1.
+func ParseAlgorithm(name string) (Algorithm, error) {
+	switch strings.ToUpper(strings.Replace(strings.TrimSpace(name), "-", "", -1)) {
+	case "", "SHA1":
+		return AlgorithmSHA1, nil
+	case "SHA256":
+		return AlgorithmSHA256, nil
+	case "SHA512":
+		return AlgorithmSHA512, nil
+	}
+	return AlgorithmSHA1, fmt.Errorf("unsupported algorithm: %s", name)
+}
+
+// String name of algorithm
+func (a Algorithm) String() string {
+	switch a {
+	case AlgorithmSHA1:
+		return "SHA1"
+	case AlgorithmSHA256:
+		return "SHA256"
+	case AlgorithmSHA512:
+		return "SHA512"
+	}
+	return fmt.Sprintf("Algorithm(%d)", int(a))
+}
+
+// Hash return hash constructor for algorithm, unknown values fall back to sha1
+func (a Algorithm) Hash() func() hash.Hash {
+	switch a {
+	case AlgorithmSHA256:
+		return sha256.New
+	case AlgorithmSHA512:
+		return sha512.New
+	}
+	return sha1.New
+}
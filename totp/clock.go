@@ -0,0 +1,35 @@
+//
+// Copyright © 2020 alexj@backpocket.com
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package totp
+
+import "time"
+
+// Clock source of the current time, lets callers generate and validate codes for a specific moment
+type Clock interface {
+	Now() time.Time
+}
+
+// SystemClock Clock returning time.Now
+type SystemClock struct{}
+
+// Now return current time
+func (SystemClock) Now() time.Time { return time.Now() }
+
+// FixedClock Clock that always returns the same time
+type FixedClock time.Time
+
+// Now return the fixed time
+func (c FixedClock) Now() time.Time { return time.Time(c) }
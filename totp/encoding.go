@@ -0,0 +1,85 @@
+//
+// Copyright © 2020 alexj@backpocket.com
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package totp
+
+import "fmt"
+
+// Encoding format codes are rendered in
+type Encoding int
+
+const (
+	// EncodingDecimal codes of codeLength decimal digits, the default
+	EncodingDecimal Encoding = iota
+	// EncodingSteam 5 character Steam Guard codes
+	EncodingSteam
+)
+
+const (
+	// SteamAlphabet characters used in Steam Guard codes
+	SteamAlphabet = "23456789BCDFGHJKMNPQRTVWXY"
+	// SteamCodeLength number of characters in Steam Guard codes
+	SteamCodeLength = 5
+)
+
+// String name of encoding
+func (e Encoding) String() string {
+	switch e {
+	case EncodingDecimal:
+		return "decimal"
+	case EncodingSteam:
+		return "steam"
+	}
+	return fmt.Sprintf("Encoding(%d)", int(e))
+}
+
+// CodeLength number of characters in codes of this encoding, codeLength is used for decimal codes
+func (e Encoding) CodeLength(codeLength int) int {
+	if e == EncodingSteam {
+		return SteamCodeLength
+	}
+
+	if codeLength == 0 {
+		return DefaultCodeLength
+	}
+	return codeLength
+}
+
+// GenerateEncodedCode generate code for challenge in encoding, codeLength is ignored for steam codes
+func GenerateEncodedCode(secret string, challenge int64, codeLength int, algorithm Algorithm, encoding Encoding) (string, error) {
+	switch encoding {
+	case EncodingDecimal:
+		return GenerateResponseCode(secret, challenge, codeLength, algorithm)
+	case EncodingSteam:
+		return GenerateSteamCode(secret, challenge, algorithm)
+	}
+	return "", fmt.Errorf("unsupported encoding: %v", encoding)
+}
+
+// GenerateSteamCode generate Steam Guard code, the truncated hash is written least significant character first
+// using SteamAlphabet. Steam uses 30 second steps and sha1.
+func GenerateSteamCode(secret string, challenge int64, algorithm Algorithm) (string, error) {
+	truncatedHash, err := generateTruncatedHash(secret, challenge, algorithm)
+	if err != nil {
+		return "", err
+	}
+
+	code := make([]byte, SteamCodeLength)
+	for i := range code {
+		code[i] = SteamAlphabet[truncatedHash%uint32(len(SteamAlphabet))]
+		truncatedHash /= uint32(len(SteamAlphabet))
+	}
+	return string(code), nil
+}
@@ -0,0 +1,103 @@
+//
+// Copyright © 2020 alexj@backpocket.com
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build go1.18
+// +build go1.18
+
+package totp
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"encoding/base32"
+	"encoding/binary"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func FuzzBase32Decode(f *testing.F) {
+	for _, seed := range []string{"", "MY======", "mzxw6ytboi", "GEZD-GNBV GY3T", "MZXW6YR=", "M", "=", "é"} {
+		f.Add(seed)
+	}
+
+	dec := DefaultNewBase32Decode()
+	f.Fuzz(func(t *testing.T, encoded string) {
+		decoded, err := dec.Decode(encoded)
+		if err != nil {
+			return
+		}
+
+		for _, reencoded := range []string{dec.Encode(decoded), dec.EncodePadded(decoded)} {
+			roundTrip, err := dec.Decode(reencoded)
+			if err != nil {
+				t.Fatalf("Decode(%q) of re-encoded %q: %v", reencoded, encoded, err)
+			}
+
+			if !bytes.Equal(roundTrip, decoded) {
+				t.Fatalf("round trip of %q got %x want %x", encoded, roundTrip, decoded)
+			}
+		}
+
+		if want := base32.StdEncoding.EncodeToString(decoded); dec.EncodePadded(decoded) != want {
+			t.Fatalf("EncodePadded(%x) got %s want %s", decoded, dec.EncodePadded(decoded), want)
+		}
+	})
+}
+
+// FuzzGenerateResponseCode compare codes against a reference built directly on the standard library
+func FuzzGenerateResponseCode(f *testing.F) {
+	f.Add([]byte("12345678901234567890"), int64(0), 6, uint8(0))
+	f.Add([]byte("12345678901234567890123456789012"), int64(37037036), 8, uint8(1))
+	f.Add([]byte{}, int64(-1), 10, uint8(2))
+
+	f.Fuzz(func(t *testing.T, secret []byte, challenge int64, digits int, alg uint8) {
+		algorithm := Algorithm(alg % 3)
+		code, err := GenerateResponseCode(DefaultNewBase32Decode().Encode(secret), challenge, digits, algorithm)
+		if digits != 0 && (digits < MinCodeLength || digits > MaxCodeLength) {
+			if err == nil {
+				t.Fatalf("digits %d: expected error", digits)
+			}
+			return
+		}
+
+		if err != nil {
+			t.Fatalf("digits %d: %v", digits, err)
+		}
+
+		if digits == 0 {
+			digits = DefaultCodeLength
+		}
+
+		msg := make([]byte, 8)
+		binary.BigEndian.PutUint64(msg, uint64(challenge))
+		mac := hmac.New(algorithm.Hash(), secret)
+		mac.Write(msg)
+		sum := mac.Sum(nil)
+		offset := sum[len(sum)-1] & 0x0F
+		value := uint64(binary.BigEndian.Uint32(sum[offset:offset+4]) & 0x7FFFFFFF)
+
+		mod := uint64(1)
+		for i := 0; i < digits; i++ {
+			mod *= 10
+		}
+		want := strconv.FormatUint(value%mod, 10)
+		want = strings.Repeat("0", digits-len(want)) + want
+
+		if code != want {
+			t.Fatalf("secret %x challenge %d digits %d %v: got %s want %s", secret, challenge, digits, algorithm, code, want)
+		}
+	})
+}
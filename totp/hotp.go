@@ -0,0 +1,97 @@
+//
+// Copyright © 2020 alexj@backpocket.com
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package totp
+
+import (
+	"crypto/subtle"
+	"fmt"
+)
+
+const (
+	// DefaultLookAhead number of counter values checked past the current counter when validating hotp codes
+	DefaultLookAhead = 10
+	// DefaultResyncLookAhead number of counter values checked past the current counter when resyncing hotp codes
+	DefaultResyncLookAhead = 100
+)
+
+// GetHotpCode generate counter based code (RFC 4226)
+func GetHotpCode(secret string, counter uint64, codeLength int, algorithm Algorithm) (string, error) {
+	return GenerateResponseCode(secret, int64(counter), codeLength, algorithm)
+}
+
+// ValidHotpCode check code against counter..counter+lookAhead, returns the counter that matched
+func ValidHotpCode(secret, code string, counter uint64, lookAhead, codeLength int, algorithm Algorithm) (uint64, bool, error) {
+	if lookAhead < 0 {
+		return 0, false, fmt.Errorf("invalid look ahead: %d, must not be negative", lookAhead)
+	}
+
+	for i := 0; i <= lookAhead; i++ {
+		c, err := GetHotpCode(secret, counter+uint64(i), codeLength, algorithm)
+		if err != nil {
+			return 0, false, err
+		}
+
+		if subtle.ConstantTimeCompare([]byte(c), []byte(code)) == 1 {
+			return counter + uint64(i), true, nil
+		}
+	}
+	return 0, false, nil
+}
+
+// ResyncHotp find the counter the token has drifted to (RFC 4226 section 7.4). codes are consecutive codes read
+// from the token, all of them must match consecutive counters within counter..counter+lookAhead. Returns the counter
+// to use for the next code.
+func ResyncHotp(secret string, codes []string, counter uint64, lookAhead, codeLength int, algorithm Algorithm) (uint64, error) {
+	if len(codes) == 0 {
+		return 0, fmt.Errorf("no codes provided to resync")
+	}
+
+	if lookAhead < 0 {
+		return 0, fmt.Errorf("invalid look ahead: %d, must not be negative", lookAhead)
+	}
+
+	start := counter
+	end := counter + uint64(lookAhead)
+	for start <= end {
+		matched, ok, err := ValidHotpCode(secret, codes[0], start, int(end-start), codeLength, algorithm)
+		if err != nil {
+			return 0, err
+		}
+
+		if !ok {
+			break
+		}
+
+		next := matched + 1
+		for _, code := range codes[1:] {
+			c, err := GetHotpCode(secret, next, codeLength, algorithm)
+			if err != nil {
+				return 0, err
+			}
+
+			if subtle.ConstantTimeCompare([]byte(c), []byte(code)) != 1 {
+				break
+			}
+			next++
+		}
+
+		if next-matched == uint64(len(codes)) {
+			return next, nil
+		}
+		start = matched + 1
+	}
+	return 0, fmt.Errorf("unable to resync, codes not found within %d of counter %d", lookAhead, counter)
+}
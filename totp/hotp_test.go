@@ -0,0 +1,92 @@
+//
+// Copyright © 2020 alexj@backpocket.com
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package totp
+
+import "testing"
+
+// rfc4226Codes 6 digit codes for counters 0 to 9 of the RFC 4226 appendix D secret
+var rfc4226Codes = []string{
+	"755224", "287082", "359152", "969429", "338314",
+	"254676", "287922", "162583", "399871", "520489",
+}
+
+func TestValidHotpCode(t *testing.T) {
+	secret := encodeSecret(rfcSecretSHA1)
+	tests := []struct {
+		name      string
+		code      string
+		counter   uint64
+		lookAhead int
+		want      uint64
+		ok        bool
+		err       bool
+	}{
+		{"current counter", rfc4226Codes[0], 0, 0, 0, true, false},
+		{"within look ahead", rfc4226Codes[3], 0, 10, 3, true, false},
+		{"at end of look ahead", rfc4226Codes[3], 1, 2, 3, true, false},
+		{"past look ahead", rfc4226Codes[3], 0, 2, 0, false, false},
+		{"behind counter", rfc4226Codes[3], 4, 10, 0, false, false},
+		{"wrong code", "000000", 0, 10, 0, false, false},
+		{"negative look ahead", rfc4226Codes[0], 0, -1, 0, false, true},
+	}
+
+	for _, tt := range tests {
+		got, ok, err := ValidHotpCode(secret, tt.code, tt.counter, tt.lookAhead, 6, AlgorithmSHA1)
+		if (err != nil) != tt.err {
+			t.Errorf("%s: err %v, want err %v", tt.name, err, tt.err)
+			continue
+		}
+
+		if ok != tt.ok || got != tt.want {
+			t.Errorf("%s: got %d, %v want %d, %v", tt.name, got, ok, tt.want, tt.ok)
+		}
+	}
+}
+
+func TestResyncHotp(t *testing.T) {
+	secret := encodeSecret(rfcSecretSHA1)
+	tests := []struct {
+		name      string
+		codes     []string
+		counter   uint64
+		lookAhead int
+		want      uint64
+		err       bool
+	}{
+		{"single code", rfc4226Codes[4:5], 0, 10, 5, false},
+		{"consecutive codes", rfc4226Codes[5:7], 0, 10, 7, false},
+		{"three consecutive codes", rfc4226Codes[2:5], 1, 5, 5, false},
+		{"codes at counter", rfc4226Codes[0:2], 0, 0, 2, false},
+		{"codes not consecutive", []string{rfc4226Codes[5], rfc4226Codes[7]}, 0, 10, 0, true},
+		{"codes in wrong order", []string{rfc4226Codes[6], rfc4226Codes[5]}, 0, 10, 0, true},
+		{"first code past look ahead", rfc4226Codes[8:10], 0, 5, 0, true},
+		{"codes behind counter", rfc4226Codes[1:3], 3, 10, 0, true},
+		{"no codes", nil, 0, 10, 0, true},
+		{"negative look ahead", rfc4226Codes[0:2], 5, -5, 0, true},
+	}
+
+	for _, tt := range tests {
+		got, err := ResyncHotp(secret, tt.codes, tt.counter, tt.lookAhead, 6, AlgorithmSHA1)
+		if (err != nil) != tt.err {
+			t.Errorf("%s: err %v, want err %v", tt.name, err, tt.err)
+			continue
+		}
+
+		if got != tt.want {
+			t.Errorf("%s: got %d want %d", tt.name, got, tt.want)
+		}
+	}
+}
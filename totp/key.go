@@ -0,0 +1,223 @@
+//
+// Copyright © 2020 alexj@backpocket.com
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package totp
+
+import (
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+const (
+	// KeyTypeTotp otpauth uri type of time based keys
+	KeyTypeTotp = "totp"
+	// KeyTypeHotp otpauth uri type of counter based keys
+	KeyTypeHotp = "hotp"
+	// KeyTypeOcra otpauth uri type of ocra keys, not part of the otpauth format, the suite is in the suite parameter
+	KeyTypeOcra = "ocra"
+	// keyTypeSteam otpauth uri type some apps use for steam keys, parsed as a totp key with EncodingSteam
+	keyTypeSteam = "steam"
+)
+
+// Key otp key as described by an otpauth uri, otpauth://TYPE/ISSUER:ACCOUNT?secret=SECRET&issuer=ISSUER&...
+type Key struct {
+	// Type key type, KeyTypeTotp, KeyTypeHotp or KeyTypeOcra
+	Type string
+	// Issuer provider or service the key belongs to
+	Issuer string
+	// Account account name, usually a user name or email
+	Account string
+	// Secret base32 encoded secret
+	Secret string
+	// Algorithm hmac algorithm
+	Algorithm Algorithm
+	// Digits number of digits, 0 when not specified (DefaultCodeLength)
+	Digits int
+	// Period seconds each totp code is valid for, 0 when not specified (Interval)
+	Period int
+	// Counter initial counter of hotp keys
+	Counter uint64
+	// Encoding code encoding, steam keys use the encoder=steam parameter
+	Encoding Encoding
+	// Suite ocra suite of ocra keys
+	Suite string
+	// Params parameters not otherwise parsed, preserved when the uri is rebuilt
+	Params url.Values
+}
+
+// ParseKey parse otpauth uri
+func ParseKey(uri string) (*Key, error) {
+	u, err := url.Parse(strings.TrimSpace(uri))
+	if err != nil {
+		return nil, fmt.Errorf("invalid otpauth uri: %v", err)
+	}
+
+	if !strings.EqualFold(u.Scheme, "otpauth") {
+		return nil, fmt.Errorf("invalid otpauth uri: unsupported scheme %s", u.Scheme)
+	}
+
+	k := &Key{Type: strings.ToLower(u.Host)}
+	switch k.Type {
+	case KeyTypeTotp, KeyTypeHotp, KeyTypeOcra:
+	case keyTypeSteam:
+		k.Type = KeyTypeTotp
+		k.Encoding = EncodingSteam
+	default:
+		return nil, fmt.Errorf("invalid otpauth uri: unsupported type %s", u.Host)
+	}
+
+	label := strings.TrimPrefix(u.Path, "/")
+	if i := strings.Index(label, ":"); i >= 0 {
+		k.Issuer = strings.TrimSpace(label[:i])
+		label = label[i+1:]
+	}
+	k.Account = strings.TrimSpace(label)
+
+	params := u.Query()
+	k.Secret = strings.ToUpper(strings.TrimRight(params.Get("secret"), string(PaddingChar)))
+	params.Del("secret")
+	if k.Secret == "" {
+		return nil, fmt.Errorf("invalid otpauth uri: missing secret")
+	}
+
+	// lenient, keys provisioned with secrets from earlier versions of NewTotpToken have non-zero trailing bits
+	_, err = DefaultNewBase32Decode().DecodeLenient(k.Secret)
+	if err != nil {
+		return nil, fmt.Errorf("invalid otpauth uri: invalid secret: %v", err)
+	}
+
+	if issuer := params.Get("issuer"); issuer != "" {
+		k.Issuer = issuer
+	}
+	params.Del("issuer")
+
+	k.Algorithm, err = ParseAlgorithm(params.Get("algorithm"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid otpauth uri: %v", err)
+	}
+	params.Del("algorithm")
+
+	if digits := params.Get("digits"); digits != "" {
+		k.Digits, err = strconv.Atoi(digits)
+		if err != nil {
+			return nil, fmt.Errorf("invalid otpauth uri: invalid digits %s", digits)
+		}
+	}
+	params.Del("digits")
+
+	if period := params.Get("period"); period != "" {
+		k.Period, err = strconv.Atoi(period)
+		if err != nil || k.Period <= 0 {
+			return nil, fmt.Errorf("invalid otpauth uri: invalid period %s", period)
+		}
+	}
+	params.Del("period")
+
+	if counter := params.Get("counter"); counter != "" {
+		k.Counter, err = strconv.ParseUint(counter, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid otpauth uri: invalid counter %s", counter)
+		}
+	} else if k.Type == KeyTypeHotp {
+		return nil, fmt.Errorf("invalid otpauth uri: missing counter for hotp key")
+	}
+	params.Del("counter")
+
+	switch encoder := params.Get("encoder"); {
+	case strings.EqualFold(encoder, EncodingSteam.String()):
+		k.Encoding = EncodingSteam
+	case encoder != "":
+		return nil, fmt.Errorf("invalid otpauth uri: unsupported encoder %s", encoder)
+	}
+	params.Del("encoder")
+
+	k.Suite = params.Get("suite")
+	params.Del("suite")
+	if k.Type == KeyTypeOcra {
+		if _, err = ParseOCRASuite(k.Suite); err != nil {
+			return nil, fmt.Errorf("invalid otpauth uri: %v", err)
+		}
+	}
+
+	if k.Encoding == EncodingDecimal && k.Digits != 0 {
+		if _, err = checkCodeLength(k.Digits); err != nil {
+			return nil, fmt.Errorf("invalid otpauth uri: %v", err)
+		}
+	}
+
+	if len(params) > 0 {
+		k.Params = params
+	}
+	return k, nil
+}
+
+// Label uri label, ISSUER:ACCOUNT or ACCOUNT when there is no issuer
+func (k *Key) Label() string {
+	if k.Issuer == "" {
+		return k.Account
+	}
+	return k.Issuer + ":" + k.Account
+}
+
+// URI build otpauth uri for key, parameters at their default value are omitted
+func (k *Key) URI() string {
+	params := url.Values{}
+	for name, values := range k.Params {
+		params[name] = append([]string(nil), values...)
+	}
+
+	params.Set("secret", k.Secret)
+	if k.Issuer != "" {
+		params.Set("issuer", k.Issuer)
+	}
+	if k.Algorithm != AlgorithmSHA1 {
+		params.Set("algorithm", k.Algorithm.String())
+	}
+	if k.Digits != 0 {
+		params.Set("digits", strconv.Itoa(k.Digits))
+	}
+	if k.Period != 0 {
+		params.Set("period", strconv.Itoa(k.Period))
+	}
+	if k.Type == KeyTypeHotp || k.Counter != 0 {
+		params.Set("counter", strconv.FormatUint(k.Counter, 10))
+	}
+	if k.Encoding == EncodingSteam {
+		params.Set("encoder", EncodingSteam.String())
+	}
+	if k.Suite != "" {
+		params.Set("suite", k.Suite)
+	}
+
+	keyType := k.Type
+	if keyType == "" {
+		keyType = KeyTypeTotp
+	}
+
+	u := url.URL{
+		Scheme:   "otpauth",
+		Host:     keyType,
+		Path:     "/" + k.Label(),
+		RawQuery: strings.Replace(params.Encode(), "+", "%20", -1),
+	}
+	return u.String()
+}
+
+// String otpauth uri of key
+func (k *Key) String() string {
+	return k.URI()
+}
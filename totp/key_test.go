@@ -0,0 +1,89 @@
+//
+// Copyright © 2020 alexj@backpocket.com
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package totp
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseKey(t *testing.T) {
+	k, err := ParseKey("otpauth://totp/ACME%20Co:john.doe@email.com?secret=hxdmvjecjjwsrb3hwizr4ifugftmxboz&issuer=ACME%20Co&algorithm=SHA256&digits=8&period=60&image=x")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := &Key{
+		Type:      KeyTypeTotp,
+		Issuer:    "ACME Co",
+		Account:   "john.doe@email.com",
+		Secret:    "HXDMVJECJJWSRB3HWIZR4IFUGFTMXBOZ",
+		Algorithm: AlgorithmSHA256,
+		Digits:    8,
+		Period:    60,
+		Params:    map[string][]string{"image": {"x"}},
+	}
+	if !reflect.DeepEqual(k, want) {
+		t.Errorf("got %+v want %+v", k, want)
+	}
+
+	uri := "otpauth://totp/ACME%20Co:john.doe@email.com?algorithm=SHA256&digits=8&image=x&issuer=ACME%20Co&period=60&secret=HXDMVJECJJWSRB3HWIZR4IFUGFTMXBOZ"
+	if k.URI() != uri {
+		t.Errorf("URI got %s want %s", k.URI(), uri)
+	}
+}
+
+func TestKeyRoundTrip(t *testing.T) {
+	keys := []*Key{
+		{Type: KeyTypeTotp, Account: "alice", Secret: "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ"},
+		{Type: KeyTypeHotp, Issuer: "Vendor", Account: "bob", Secret: "MZXW6YTBOI", Digits: 8, Algorithm: AlgorithmSHA512},
+		{Type: KeyTypeHotp, Account: "carol", Secret: "MZXW6YTBOI", Counter: 42},
+		{Type: KeyTypeTotp, Issuer: "Steam", Account: "dave", Secret: "MZXW6YTBOI", Encoding: EncodingSteam},
+		{Type: KeyTypeOcra, Issuer: "Bank", Account: "erin", Secret: "MZXW6YTBOI", Suite: "OCRA-1:HOTP-SHA1-6:QN08", Counter: 3},
+	}
+
+	for _, k := range keys {
+		parsed, err := ParseKey(k.URI())
+		if err != nil {
+			t.Fatalf("%s: %v", k.URI(), err)
+		}
+
+		if !reflect.DeepEqual(parsed, k) {
+			t.Errorf("%s: got %+v want %+v", k.URI(), parsed, k)
+		}
+	}
+}
+
+func TestParseKeyInvalid(t *testing.T) {
+	invalid := []string{
+		"http://totp/a?secret=MZXW6YTBOI",
+		"otpauth://motp/a?secret=MZXW6YTBOI",
+		"otpauth://totp/a",
+		"otpauth://totp/a?secret=M1",
+		"otpauth://totp/a?secret=MZXW6YTBOI&algorithm=MD5",
+		"otpauth://totp/a?secret=MZXW6YTBOI&digits=x",
+		"otpauth://totp/a?secret=MZXW6YTBOI&digits=3",
+		"otpauth://totp/a?secret=MZXW6YTBOI&period=0",
+		"otpauth://hotp/a?secret=MZXW6YTBOI",
+		"otpauth://ocra/a?secret=MZXW6YTBOI&suite=OCRA-2",
+	}
+
+	for _, uri := range invalid {
+		if k, err := ParseKey(uri); err == nil {
+			t.Errorf("ParseKey(%q) got %+v expected error", uri, k)
+		}
+	}
+}
@@ -0,0 +1,207 @@
+//
+// Copyright © 2020 alexj@backpocket.com
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package totp
+
+import (
+	"encoding/base64"
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+// MigrationScheme scheme of Google Authenticator export uris, otpauth-migration://offline?data=BASE64
+const MigrationScheme = "otpauth-migration"
+
+// protobuf wire types used by the migration payload
+const (
+	wireVarint  = 0
+	wireFixed64 = 1
+	wireBytes   = 2
+	wireFixed32 = 5
+)
+
+// ParseMigrationURI parse Google Authenticator otpauth-migration uri into keys. The data parameter is a base64
+// encoded MigrationPayload protobuf message, decoded here without a protobuf dependency.
+func ParseMigrationURI(uri string) ([]*Key, error) {
+	u, err := url.Parse(strings.TrimSpace(uri))
+	if err != nil {
+		return nil, fmt.Errorf("invalid migration uri: %v", err)
+	}
+
+	if !strings.EqualFold(u.Scheme, MigrationScheme) {
+		return nil, fmt.Errorf("invalid migration uri: unsupported scheme %s", u.Scheme)
+	}
+
+	data := u.Query().Get("data")
+	if data == "" {
+		return nil, fmt.Errorf("invalid migration uri: missing data")
+	}
+
+	payload, err := base64.StdEncoding.DecodeString(data)
+	if err != nil {
+		payload, err = base64.RawStdEncoding.DecodeString(data)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("invalid migration uri: invalid data: %v", err)
+	}
+
+	var keys []*Key
+	err = readProtobuf(payload, func(field int, wireType int, value uint64, bytes []byte) error {
+		// MigrationPayload.otp_parameters = 1, version, batch fields are ignored
+		if field != 1 || wireType != wireBytes {
+			return nil
+		}
+
+		k, err := parseMigrationParameters(bytes)
+		if err != nil {
+			return err
+		}
+		keys = append(keys, k)
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("invalid migration uri: %v", err)
+	}
+	return keys, nil
+}
+
+// parseMigrationParameters parse MigrationPayload.OtpParameters message
+func parseMigrationParameters(msg []byte) (*Key, error) {
+	k := &Key{Type: KeyTypeTotp}
+	var name string
+	err := readProtobuf(msg, func(field int, wireType int, value uint64, bytes []byte) error {
+		switch {
+		case field == 1 && wireType == wireBytes:
+			k.Secret = DefaultNewBase32Decode().Encode(bytes)
+		case field == 2 && wireType == wireBytes:
+			name = string(bytes)
+		case field == 3 && wireType == wireBytes:
+			k.Issuer = string(bytes)
+		case field == 4 && wireType == wireVarint:
+			switch value {
+			case 0, 1:
+				k.Algorithm = AlgorithmSHA1
+			case 2:
+				k.Algorithm = AlgorithmSHA256
+			case 3:
+				k.Algorithm = AlgorithmSHA512
+			default:
+				return fmt.Errorf("unsupported algorithm: %d", value)
+			}
+		case field == 5 && wireType == wireVarint:
+			switch value {
+			case 0:
+			case 1:
+				k.Digits = 6
+			case 2:
+				k.Digits = 8
+			default:
+				return fmt.Errorf("unsupported digit count: %d", value)
+			}
+		case field == 6 && wireType == wireVarint:
+			switch value {
+			case 0, 2:
+				k.Type = KeyTypeTotp
+			case 1:
+				k.Type = KeyTypeHotp
+			default:
+				return fmt.Errorf("unsupported otp type: %d", value)
+			}
+		case field == 7 && wireType == wireVarint:
+			k.Counter = value
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if k.Secret == "" {
+		return nil, fmt.Errorf("missing secret for %s", name)
+	}
+
+	if i := strings.Index(name, ":"); i >= 0 && (k.Issuer == "" || strings.TrimSpace(name[:i]) == k.Issuer) {
+		if k.Issuer == "" {
+			k.Issuer = strings.TrimSpace(name[:i])
+		}
+		name = name[i+1:]
+	}
+	k.Account = strings.TrimSpace(name)
+	return k, nil
+}
+
+// readProtobuf call fn for each field of a protobuf message, value holds varint and fixed values, bytes holds
+// length delimited values
+func readProtobuf(msg []byte, fn func(field int, wireType int, value uint64, bytes []byte) error) error {
+	for len(msg) > 0 {
+		tag, n := readVarint(msg)
+		if n == 0 {
+			return fmt.Errorf("truncated field tag")
+		}
+		msg = msg[n:]
+
+		field := int(tag >> 3)
+		wireType := int(tag & 0x7)
+		var value uint64
+		var bytes []byte
+		switch wireType {
+		case wireVarint:
+			value, n = readVarint(msg)
+			if n == 0 {
+				return fmt.Errorf("truncated varint field %d", field)
+			}
+			msg = msg[n:]
+		case wireFixed64, wireFixed32:
+			size := 8
+			if wireType == wireFixed32 {
+				size = 4
+			}
+			if len(msg) < size {
+				return fmt.Errorf("truncated fixed field %d", field)
+			}
+			for i := size - 1; i >= 0; i-- {
+				value = value<<8 | uint64(msg[i])
+			}
+			msg = msg[size:]
+		case wireBytes:
+			length, n := readVarint(msg)
+			if n == 0 || length > uint64(len(msg)-n) {
+				return fmt.Errorf("truncated bytes field %d", field)
+			}
+			bytes = msg[n : n+int(length)]
+			msg = msg[n+int(length):]
+		default:
+			return fmt.Errorf("unsupported wire type %d for field %d", wireType, field)
+		}
+
+		if err := fn(field, wireType, value, bytes); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// readVarint read protobuf base 128 varint, returns the value and number of bytes read, 0 if msg is truncated
+func readVarint(msg []byte) (uint64, int) {
+	var value uint64
+	for i := 0; i < len(msg) && i < 10; i++ {
+		value |= uint64(msg[i]&0x7F) << (7 * uint(i))
+		if msg[i] < 0x80 {
+			return value, i + 1
+		}
+	}
+	return 0, 0
+}
@@ -0,0 +1,91 @@
+//
+// Copyright © 2020 alexj@backpocket.com
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package totp
+
+import (
+	"encoding/base64"
+	"net/url"
+	"reflect"
+	"testing"
+)
+
+func appendVarint(b []byte, v uint64) []byte {
+	for v >= 0x80 {
+		b = append(b, byte(v)|0x80)
+		v >>= 7
+	}
+	return append(b, byte(v))
+}
+
+func appendField(b []byte, field int, value interface{}) []byte {
+	switch v := value.(type) {
+	case uint64:
+		b = appendVarint(b, uint64(field)<<3|wireVarint)
+		return appendVarint(b, v)
+	case string:
+		return appendField(b, field, []byte(v))
+	case []byte:
+		b = appendVarint(b, uint64(field)<<3|wireBytes)
+		b = appendVarint(b, uint64(len(v)))
+		return append(b, v...)
+	}
+	panic("unsupported field type")
+}
+
+func TestParseMigrationURI(t *testing.T) {
+	var totpParams, hotpParams, payload []byte
+	totpParams = appendField(totpParams, 1, rfcSecretSHA1)
+	totpParams = appendField(totpParams, 2, "ACME:alice@example.com")
+	totpParams = appendField(totpParams, 3, "ACME")
+	totpParams = appendField(totpParams, 4, uint64(2))
+	totpParams = appendField(totpParams, 5, uint64(2))
+	totpParams = appendField(totpParams, 6, uint64(2))
+
+	hotpParams = appendField(hotpParams, 1, []byte("foobar"))
+	hotpParams = appendField(hotpParams, 2, "bob")
+	hotpParams = appendField(hotpParams, 6, uint64(1))
+	hotpParams = appendField(hotpParams, 7, uint64(300))
+
+	payload = appendField(payload, 1, totpParams)
+	payload = appendField(payload, 1, hotpParams)
+	payload = appendField(payload, 2, uint64(1))
+	payload = appendField(payload, 3, uint64(1))
+
+	uri := "otpauth-migration://offline?data=" + url.QueryEscape(base64.StdEncoding.EncodeToString(payload))
+	keys, err := ParseMigrationURI(uri)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []*Key{
+		{Type: KeyTypeTotp, Issuer: "ACME", Account: "alice@example.com", Secret: encodeSecret(rfcSecretSHA1), Algorithm: AlgorithmSHA256, Digits: 8},
+		{Type: KeyTypeHotp, Account: "bob", Secret: "MZXW6YTBOI", Counter: 300},
+	}
+	if !reflect.DeepEqual(keys, want) {
+		t.Errorf("got %+v %+v want %+v %+v", keys[0], keys[1], want[0], want[1])
+	}
+
+	for _, invalid := range []string{
+		"otpauth://totp/a?secret=MZXW6YTBOI",
+		"otpauth-migration://offline",
+		"otpauth-migration://offline?data=%25%25",
+		"otpauth-migration://offline?data=" + base64.StdEncoding.EncodeToString(payload[:len(payload)-5]),
+	} {
+		if _, err := ParseMigrationURI(invalid); err == nil {
+			t.Errorf("ParseMigrationURI(%q) expected error", invalid)
+		}
+	}
+}
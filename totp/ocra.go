@@ -0,0 +1,268 @@
+//
+// Copyright © 2020 alexj@backpocket.com
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package totp
+
+import (
+	"crypto/hmac"
+	"encoding/hex"
+	"fmt"
+	"math/big"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// ocraVersion only version of the OCRA suite format (RFC 6287 section 6.1)
+	ocraVersion = "OCRA-1"
+	// ocraChallengeBytes challenges are padded to 128 bytes
+	ocraChallengeBytes = 128
+)
+
+// OCRASuite parsed OCRA suite string (RFC 6287 section 6), e.g. OCRA-1:HOTP-SHA1-6:QN08-PSHA1
+type OCRASuite struct {
+	// Suite suite string as parsed
+	Suite string
+	// Algorithm hmac algorithm of the crypto function
+	Algorithm Algorithm
+	// Digits number of digits in the response, 4 to 10
+	Digits int
+	// Counter response uses a counter
+	Counter bool
+	// ChallengeFormat format of the challenge, 'A' alphanumeric, 'N' numeric or 'H' hex
+	ChallengeFormat byte
+	// ChallengeLength maximum length of the challenge
+	ChallengeLength int
+	// PIN response uses a hashed PIN
+	PIN bool
+	// PINAlgorithm hash algorithm of the PIN
+	PINAlgorithm Algorithm
+	// SessionLength number of bytes of session information, 0 when not used
+	SessionLength int
+	// TimeStep size of timestamp steps, 0 when the response does not use a timestamp
+	TimeStep time.Duration
+}
+
+// OCRAInput values combined with the challenge to compute a response, only the ones the suite uses are read
+type OCRAInput struct {
+	// Counter counter value, synchronized between client and server
+	Counter uint64
+	// Challenge challenge supplied by the server
+	Challenge string
+	// PIN PIN, hashed with the suite's PIN algorithm
+	PIN string
+	// PINHash precomputed hash of the PIN, used instead of PIN when set
+	PINHash []byte
+	// Session session information, left padded with zeros to the suite's session length
+	Session []byte
+	// Time time the response is computed for
+	Time time.Time
+}
+
+// ParseOCRASuite parse and validate an OCRA suite string
+func ParseOCRASuite(suite string) (*OCRASuite, error) {
+	parts := strings.Split(suite, ":")
+	if len(parts) != 3 {
+		return nil, fmt.Errorf("invalid ocra suite: %s, expected 3 parts", suite)
+	}
+
+	if parts[0] != ocraVersion {
+		return nil, fmt.Errorf("invalid ocra suite: %s, unsupported version %s", suite, parts[0])
+	}
+
+	s := &OCRASuite{Suite: suite}
+	crypto := strings.Split(parts[1], "-")
+	if len(crypto) != 3 || crypto[0] != "HOTP" {
+		return nil, fmt.Errorf("invalid ocra suite: %s, invalid crypto function %s", suite, parts[1])
+	}
+
+	var err error
+	s.Algorithm, err = ParseAlgorithm(crypto[1])
+	if err != nil {
+		return nil, fmt.Errorf("invalid ocra suite: %s, %v", suite, err)
+	}
+
+	s.Digits, err = strconv.Atoi(crypto[2])
+	if err != nil || s.Digits < 4 || s.Digits > MaxCodeLength {
+		return nil, fmt.Errorf("invalid ocra suite: %s, unsupported truncation %s", suite, crypto[2])
+	}
+
+	for i, input := range strings.Split(parts[2], "-") {
+		switch {
+		case input == "C" && i == 0:
+			s.Counter = true
+
+		case strings.HasPrefix(input, "Q") && s.ChallengeFormat == 0 && len(input) == 4:
+			s.ChallengeFormat = input[1]
+			if !strings.ContainsRune("ANH", rune(s.ChallengeFormat)) {
+				return nil, fmt.Errorf("invalid ocra suite: %s, unsupported challenge format %c", suite, s.ChallengeFormat)
+			}
+
+			s.ChallengeLength, err = strconv.Atoi(input[2:])
+			if err != nil || s.ChallengeLength < 4 || s.ChallengeLength > 64 {
+				return nil, fmt.Errorf("invalid ocra suite: %s, invalid challenge length %s", suite, input[2:])
+			}
+
+		case strings.HasPrefix(input, "P") && s.ChallengeFormat != 0 && !s.PIN:
+			s.PIN = true
+			s.PINAlgorithm, err = ParseAlgorithm(input[1:])
+			if err != nil {
+				return nil, fmt.Errorf("invalid ocra suite: %s, invalid pin hash %s", suite, input)
+			}
+
+		case strings.HasPrefix(input, "S") && s.ChallengeFormat != 0 && s.SessionLength == 0:
+			s.SessionLength, err = strconv.Atoi(input[1:])
+			if err != nil || len(input) != 4 || s.SessionLength <= 0 {
+				return nil, fmt.Errorf("invalid ocra suite: %s, invalid session information %s", suite, input)
+			}
+
+		case strings.HasPrefix(input, "T") && s.ChallengeFormat != 0 && s.TimeStep == 0:
+			s.TimeStep, err = parseOCRATimeStep(input[1:])
+			if err != nil {
+				return nil, fmt.Errorf("invalid ocra suite: %s, %v", suite, err)
+			}
+
+		default:
+			return nil, fmt.Errorf("invalid ocra suite: %s, unexpected data input %s", suite, input)
+		}
+	}
+
+	if s.ChallengeFormat == 0 {
+		return nil, fmt.Errorf("invalid ocra suite: %s, missing challenge", suite)
+	}
+	return s, nil
+}
+
+// parseOCRATimeStep parse time step of timestamp data input, e.g. 30S, 1M, 24H
+func parseOCRATimeStep(step string) (time.Duration, error) {
+	if len(step) < 2 {
+		return 0, fmt.Errorf("invalid time step %s", step)
+	}
+
+	n, err := strconv.Atoi(step[:len(step)-1])
+	if err != nil {
+		return 0, fmt.Errorf("invalid time step %s", step)
+	}
+
+	switch step[len(step)-1] {
+	case 'S':
+		if n >= 1 && n <= 59 {
+			return time.Duration(n) * time.Second, nil
+		}
+	case 'M':
+		if n >= 1 && n <= 59 {
+			return time.Duration(n) * time.Minute, nil
+		}
+	case 'H':
+		if n >= 1 && n <= 48 {
+			return time.Duration(n) * time.Hour, nil
+		}
+	}
+	return 0, fmt.Errorf("invalid time step %s", step)
+}
+
+// Compute compute the response for input using key (RFC 6287 section 7.1)
+func (s *OCRASuite) Compute(key []byte, input OCRAInput) (string, error) {
+	msg := append([]byte(s.Suite), 0)
+
+	if s.Counter {
+		msg = append(msg, int64ToBytes(int64(input.Counter))...)
+	}
+
+	challenge, err := s.encodeChallenge(input.Challenge)
+	if err != nil {
+		return "", err
+	}
+	msg = append(msg, challenge...)
+
+	if s.PIN {
+		pinHash := input.PINHash
+		if pinHash == nil {
+			h := s.PINAlgorithm.Hash()()
+			h.Write([]byte(input.PIN))
+			pinHash = h.Sum(nil)
+		}
+
+		if len(pinHash) != s.PINAlgorithm.Hash()().Size() {
+			return "", fmt.Errorf("invalid pin hash length: %d bytes for %v", len(pinHash), s.PINAlgorithm)
+		}
+		msg = append(msg, pinHash...)
+	}
+
+	if s.SessionLength > 0 {
+		if len(input.Session) > s.SessionLength {
+			return "", fmt.Errorf("session information too long: %d bytes, max %d", len(input.Session), s.SessionLength)
+		}
+		msg = append(msg, make([]byte, s.SessionLength-len(input.Session))...)
+		msg = append(msg, input.Session...)
+	}
+
+	if s.TimeStep > 0 {
+		steps := input.Time.Unix() / int64(s.TimeStep/time.Second)
+		msg = append(msg, int64ToBytes(steps)...)
+	}
+
+	mac := hmac.New(s.Algorithm.Hash(), key)
+	mac.Write(msg)
+	hash := mac.Sum(nil)
+
+	offset := int(hash[len(hash)-1] & 0x0F)
+	truncatedHash := hashToInt(hash, offset) & 0x7FFFFFFF
+	code := strconv.FormatUint(uint64(truncatedHash)%digitsPower[s.Digits], 10)
+	return strings.Repeat("0", s.Digits-len(code)) + code, nil
+}
+
+// encodeChallenge convert challenge to bytes according to the suite challenge format, padded to 128 bytes
+func (s *OCRASuite) encodeChallenge(challenge string) ([]byte, error) {
+	if len(challenge) < 4 || len(challenge) > s.ChallengeLength {
+		return nil, fmt.Errorf("invalid challenge length: %d, must be between 4 and %d", len(challenge), s.ChallengeLength)
+	}
+
+	var hexChallenge string
+	switch s.ChallengeFormat {
+	case 'N':
+		n, ok := new(big.Int).SetString(challenge, 10)
+		if !ok || n.Sign() < 0 {
+			return nil, fmt.Errorf("invalid numeric challenge: %s", challenge)
+		}
+		hexChallenge = n.Text(16)
+	case 'A':
+		hexChallenge = hex.EncodeToString([]byte(challenge))
+	case 'H':
+		hexChallenge = challenge
+	}
+
+	hexChallenge += strings.Repeat("0", ocraChallengeBytes*2-len(hexChallenge))
+	decoded, err := hex.DecodeString(hexChallenge)
+	if err != nil {
+		return nil, fmt.Errorf("invalid hex challenge: %s", challenge)
+	}
+	return decoded, nil
+}
+
+// GenerateOCRAResponse compute the response for suite using a base32 encoded secret
+func GenerateOCRAResponse(secret, suite string, input OCRAInput) (string, error) {
+	s, err := ParseOCRASuite(suite)
+	if err != nil {
+		return "", err
+	}
+
+	key, err := DefaultNewBase32Decode().DecodeLenient(secret)
+	if err != nil {
+		return "", err
+	}
+	return s.Compute(key, input)
+}
@@ -0,0 +1,93 @@
+//
+// Copyright © 2020 alexj@backpocket.com
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package totp
+
+import (
+	"testing"
+	"time"
+)
+
+// TestOCRARFC6287 RFC 6287 appendix C.1 one-way challenge response vectors
+func TestOCRARFC6287(t *testing.T) {
+	pin := "1234"
+	timestamp := time.Unix(0x132d0b6*60, 0)
+
+	vectors := []struct {
+		suite string
+		key   []byte
+		input OCRAInput
+		want  string
+	}{
+		{"OCRA-1:HOTP-SHA1-6:QN08", rfcSecretSHA1, OCRAInput{Challenge: "00000000"}, "237653"},
+		{"OCRA-1:HOTP-SHA1-6:QN08", rfcSecretSHA1, OCRAInput{Challenge: "11111111"}, "243178"},
+		{"OCRA-1:HOTP-SHA1-6:QN08", rfcSecretSHA1, OCRAInput{Challenge: "55555555"}, "388898"},
+		{"OCRA-1:HOTP-SHA1-6:QN08", rfcSecretSHA1, OCRAInput{Challenge: "99999999"}, "294470"},
+		{"OCRA-1:HOTP-SHA256-8:C-QN08-PSHA1", rfcSecretSHA256, OCRAInput{Counter: 0, Challenge: "12345678", PIN: pin}, "65347737"},
+		{"OCRA-1:HOTP-SHA256-8:C-QN08-PSHA1", rfcSecretSHA256, OCRAInput{Counter: 1, Challenge: "12345678", PIN: pin}, "86775851"},
+		{"OCRA-1:HOTP-SHA256-8:C-QN08-PSHA1", rfcSecretSHA256, OCRAInput{Counter: 9, Challenge: "12345678", PIN: pin}, "08522129"},
+		{"OCRA-1:HOTP-SHA256-8:QN08-PSHA1", rfcSecretSHA256, OCRAInput{Challenge: "00000000", PIN: pin}, "83238735"},
+		{"OCRA-1:HOTP-SHA256-8:QN08-PSHA1", rfcSecretSHA256, OCRAInput{Challenge: "44444444", PIN: pin}, "86807031"},
+		{"OCRA-1:HOTP-SHA512-8:C-QN08", rfcSecretSHA512, OCRAInput{Counter: 0, Challenge: "00000000"}, "07016083"},
+		{"OCRA-1:HOTP-SHA512-8:C-QN08", rfcSecretSHA512, OCRAInput{Counter: 9, Challenge: "99999999"}, "31409299"},
+		{"OCRA-1:HOTP-SHA512-8:QN08-T1M", rfcSecretSHA512, OCRAInput{Challenge: "00000000", Time: timestamp}, "95209754"},
+		{"OCRA-1:HOTP-SHA512-8:QN08-T1M", rfcSecretSHA512, OCRAInput{Challenge: "44444444", Time: timestamp}, "36209546"},
+	}
+
+	for _, v := range vectors {
+		suite, err := ParseOCRASuite(v.suite)
+		if err != nil {
+			t.Fatalf("%s: %v", v.suite, err)
+		}
+
+		got, err := suite.Compute(v.key, v.input)
+		if err != nil {
+			t.Fatalf("%s %+v: %v", v.suite, v.input, err)
+		}
+
+		if got != v.want {
+			t.Errorf("%s %+v: got %s want %s", v.suite, v.input, got, v.want)
+		}
+	}
+}
+
+func TestParseOCRASuite(t *testing.T) {
+	s, err := ParseOCRASuite("OCRA-1:HOTP-SHA256-8:C-QA10-PSHA512-S064-T30S")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if s.Algorithm != AlgorithmSHA256 || s.Digits != 8 || !s.Counter || s.ChallengeFormat != 'A' || s.ChallengeLength != 10 ||
+		!s.PIN || s.PINAlgorithm != AlgorithmSHA512 || s.SessionLength != 64 || s.TimeStep != 30*time.Second {
+		t.Errorf("unexpected suite %+v", s)
+	}
+
+	invalid := []string{
+		"",
+		"OCRA-2:HOTP-SHA1-6:QN08",
+		"OCRA-1:HOTP-MD5-6:QN08",
+		"OCRA-1:HOTP-SHA1-3:QN08",
+		"OCRA-1:HOTP-SHA1-6:C",
+		"OCRA-1:HOTP-SHA1-6:QX08",
+		"OCRA-1:HOTP-SHA1-6:QN65",
+		"OCRA-1:HOTP-SHA1-6:QN08-C",
+		"OCRA-1:HOTP-SHA1-6:QN08-T60M",
+	}
+	for _, suite := range invalid {
+		if _, err := ParseOCRASuite(suite); err == nil {
+			t.Errorf("ParseOCRASuite(%q) expected error", suite)
+		}
+	}
+}
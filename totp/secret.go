@@ -0,0 +1,48 @@
+//
+// Copyright © 2020 alexj@backpocket.com
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package totp
+
+import (
+	"crypto/rand"
+	"fmt"
+)
+
+const (
+	// DefaultSecretBits entropy of generated secrets, RFC 4226 section 4 recommends 160 bits
+	DefaultSecretBits = 160
+	// MinSecretBits minimum entropy of generated secrets, RFC 4226 section 4 requires 128 bits
+	MinSecretBits = 128
+)
+
+// GenerateSecret generate a random secret using crypto/rand with the given entropy in bits, 0 uses
+// DefaultSecretBits. bits must be a multiple of 8. Returns the raw secret and the unpadded base32 encoded secret.
+func GenerateSecret(bits int) ([]byte, string, error) {
+	if bits == 0 {
+		bits = DefaultSecretBits
+	}
+
+	if bits < MinSecretBits || bits%8 != 0 {
+		return nil, "", fmt.Errorf("invalid secret size: %d bits, must be a multiple of 8 and at least %d", bits, MinSecretBits)
+	}
+
+	raw := make([]byte, bits/8)
+	_, err := rand.Read(raw)
+	if err != nil {
+		return nil, "", fmt.Errorf("unable to read random bytes: %v", err)
+	}
+
+	return raw, DefaultNewBase32Decode().Encode(raw), nil
+}
@@ -0,0 +1,145 @@
+//
+// Copyright © 2020 alexj@backpocket.com
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package totp
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// Record validation state of a subject
+type Record struct {
+	// LastStep last accepted time step, 0 when no code has been accepted
+	LastStep int64 `json:"last_step,omitempty"`
+	// Failures number of consecutive failed attempts
+	Failures int `json:"failures,omitempty"`
+	// LockedUntil attempts are rejected until this time
+	LockedUntil time.Time `json:"locked_until,omitempty"`
+}
+
+// Store persists Validator records, implementations must be safe for concurrent use
+type Store interface {
+	// Load return record for subject, a zero Record when the subject is unknown
+	Load(subject string) (Record, error)
+	// Save store record for subject
+	Save(subject string, rec Record) error
+}
+
+// MemoryStore Store held in memory
+type MemoryStore struct {
+	mu      sync.Mutex
+	records map[string]Record
+}
+
+// NewMemoryStore create empty MemoryStore
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{records: make(map[string]Record)}
+}
+
+// Load return record for subject
+func (s *MemoryStore) Load(subject string) (Record, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.records[subject], nil
+}
+
+// Save store record for subject
+func (s *MemoryStore) Save(subject string, rec Record) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.records[subject] = rec
+	return nil
+}
+
+// FileStore Store persisted as a json object keyed by subject. The file is rewritten through a temp file and
+// rename on every save, it is intended for a single process with a modest number of subjects.
+type FileStore struct {
+	mu   sync.Mutex
+	path string
+}
+
+// NewFileStore create FileStore backed by path, the file is created on the first save
+func NewFileStore(path string) *FileStore {
+	return &FileStore{path: path}
+}
+
+// Load return record for subject
+func (s *FileStore) Load(subject string) (Record, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	records, err := s.read()
+	if err != nil {
+		return Record{}, err
+	}
+	return records[subject], nil
+}
+
+// Save store record for subject
+func (s *FileStore) Save(subject string, rec Record) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	records, err := s.read()
+	if err != nil {
+		return err
+	}
+	records[subject] = rec
+
+	data, err := json.Marshal(records)
+	if err != nil {
+		return err
+	}
+
+	f, err := ioutil.TempFile(filepath.Dir(s.path), filepath.Base(s.path)+".tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+
+	_, err = f.Write(data)
+	if err == nil {
+		err = f.Sync()
+	}
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+	return os.Rename(f.Name(), s.path)
+}
+
+func (s *FileStore) read() (map[string]Record, error) {
+	records := make(map[string]Record)
+	data, err := ioutil.ReadFile(s.path)
+	if os.IsNotExist(err) {
+		return records, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	err = json.Unmarshal(data, &records)
+	if err != nil {
+		return nil, err
+	}
+	return records, nil
+}
@@ -17,9 +17,8 @@ package totp
 
 import (
 	"crypto/hmac"
-	"crypto/sha1"
+	"crypto/rand"
 	"fmt"
-	"math/rand"
 	"strconv"
 	"strings"
 	"time"
@@ -28,10 +27,20 @@ import (
 const (
 	// Interval for totp tokens
 	Interval = 30
-	// PinModulo pin mod value
+	// PinModulo pin mod value for 6 digit codes
+	//
+	// Deprecated: the modulus is derived from the requested code length, see digitsPower.
 	PinModulo = 1000000
+	// MinCodeLength minimum number of digits in a generated code (RFC 4226 section 5.3)
+	MinCodeLength = 6
+	// MaxCodeLength maximum number of digits in a generated code, a 31 bit truncated hash has at most 10 digits
+	MaxCodeLength = 10
+	// DefaultCodeLength number of digits used when a code length of 0 is requested
+	DefaultCodeLength = 6
 	// DefaultBase32String base 32 characters
 	DefaultBase32String = "ABCDEFGHIJKLMNOPQRSTUVWXYZ234567"
+	// PaddingChar base 32 padding character
+	PaddingChar = '='
 )
 
 var (
@@ -43,6 +52,9 @@ var (
 		32, 0, 1, 26, 2, 23, 27, 0, 3, 16, 24, 30, 28, 11, 0, 13, 4, 7, 17,
 		0, 25, 22, 31, 15, 29, 10, 12, 6, 0, 21, 14, 9, 5, 20, 8, 19, 18,
 	}
+
+	// digitsPower modulus for each supported code length, indexed by number of digits
+	digitsPower = []uint64{1, 10, 100, 1000, 10000, 100000, 1000000, 10000000, 100000000, 1000000000, 10000000000}
 )
 
 // Base32Decode struct
@@ -71,27 +83,52 @@ func NewBase32Decode(encode string) *Base32Decode {
 	return d
 }
 
-// Decode Base 32 Decode of encoded string
+// Decode Base 32 Decode of encoded string (RFC 4648 section 6). Input is case-insensitive, may contain spaces or
+// dashes for readability and may be padded with '=' or unpadded. Encodings with an invalid length or non-zero
+// trailing bits are rejected.
 func (dec *Base32Decode) Decode(encoded string) ([]byte, error) {
+	return dec.decode(encoded, true)
+}
+
+// DecodeLenient Base 32 Decode of encoded string like Decode, but leftover bits that do not make up a whole byte
+// are dropped instead of rejected. Use it for secrets stored by earlier versions, which did not check them.
+func (dec *Base32Decode) DecodeLenient(encoded string) ([]byte, error) {
+	return dec.decode(encoded, false)
+}
+
+func (dec *Base32Decode) decode(encoded string, strict bool) ([]byte, error) {
 	encoded = strings.TrimSpace(encoded)
 	encoded = strings.Replace(encoded, "-", "", -1)
 	encoded = strings.Replace(encoded, " ", "", -1)
 	encoded = strings.ToUpper(encoded)
+
+	unpadded := strings.TrimRight(encoded, string(PaddingChar))
+	if padding := len(encoded) - len(unpadded); padding > 0 {
+		if len(encoded)%8 != 0 || padding >= 8 {
+			return nil, fmt.Errorf("invalid padding: %d padding chars in %d chars", padding, len(encoded))
+		}
+	}
+	encoded = unpadded
+
 	if encoded == "" {
 		return []byte{}, nil
 	}
 	MASK := len(dec.encode) - 1
 	SHIFT := uint(numberOfTrailingZeros(len(dec.encode)))
 	encodedLength := len(encoded)
+	if strict && (encodedLength*int(SHIFT))%8 >= int(SHIFT) {
+		return nil, fmt.Errorf("invalid length: %d chars", encodedLength)
+	}
 	outLength := encodedLength * int(SHIFT) / 8
 	result := make([]byte, outLength)
 	buffer := 0
 	next := 0
 	bitsLeft := 0
-	for _, c := range encoded {
+	for i := 0; i < encodedLength; i++ {
+		c := encoded[i]
 		x := dec.decodeMap[c]
 		if x == 0xFF {
-			return nil, fmt.Errorf("char illegal: %c", c)
+			return nil, fmt.Errorf("char illegal: %q at %d", c, i)
 		}
 		buffer <<= SHIFT
 		buffer |= int(x) & MASK
@@ -101,10 +138,50 @@ func (dec *Base32Decode) Decode(encoded string) ([]byte, error) {
 			next++
 			bitsLeft -= 8
 		}
+		buffer &= (1 << uint(bitsLeft)) - 1
+	}
+
+	if strict && buffer != 0 {
+		return nil, fmt.Errorf("invalid trailing bits: last char %q has non-zero unused bits", encoded[encodedLength-1])
 	}
 	return result, nil
 }
 
+// Encode Base 32 Encode of data without padding, the form used by otpauth uris
+func (dec *Base32Decode) Encode(data []byte) string {
+	MASK := len(dec.encode) - 1
+	SHIFT := uint(numberOfTrailingZeros(len(dec.encode)))
+
+	var sb strings.Builder
+	sb.Grow((len(data)*8 + int(SHIFT) - 1) / int(SHIFT))
+	buffer := 0
+	bitsLeft := 0
+	for _, b := range data {
+		buffer <<= 8
+		buffer |= int(b)
+		bitsLeft += 8
+		for bitsLeft >= int(SHIFT) {
+			sb.WriteByte(dec.encode[(buffer>>uint(bitsLeft-int(SHIFT)))&MASK])
+			bitsLeft -= int(SHIFT)
+		}
+		buffer &= (1 << uint(bitsLeft)) - 1
+	}
+
+	if bitsLeft > 0 {
+		sb.WriteByte(dec.encode[(buffer<<(SHIFT-uint(bitsLeft)))&MASK])
+	}
+	return sb.String()
+}
+
+// EncodePadded Base 32 Encode of data padded with '=' to a multiple of 8 chars
+func (dec *Base32Decode) EncodePadded(data []byte) string {
+	encoded := dec.Encode(data)
+	if rem := len(encoded) % 8; rem != 0 {
+		encoded += strings.Repeat(string(PaddingChar), 8-rem)
+	}
+	return encoded
+}
+
 func numberOfTrailingZeros(i int) int {
 	return ZerosOnRightModLookup[(i&-i)%37]
 }
@@ -129,33 +206,53 @@ func hashToInt(bytes []byte, start int) uint32 {
 	return result
 }
 
-func getCurrentTimeMillis() int64 {
-	return time.Now().UnixNano() / 1000 / 1000
+// GetChallenge value, the number of period second steps since the unix epoch.
+// A period of zero uses the default Interval.
+func GetChallenge(period int) int64 {
+	return GetChallengeAt(time.Now(), period)
 }
 
-// GetChallenge value
-func GetChallenge() int64 {
-	return getCurrentTimeMillis() / 1000 / Interval
+// GetChallengeAt value at time t, the number of period second steps between the unix epoch and t.
+// A period of zero uses the default Interval.
+func GetChallengeAt(t time.Time, period int) int64 {
+	if period <= 0 {
+		period = Interval
+	}
+
+	secs := t.Unix()
+	if secs < 0 {
+		// round toward negative infinity so steps before the epoch are period seconds long as well
+		return (secs - int64(period) + 1) / int64(period)
+	}
+	return secs / int64(period)
 }
 
-// GenerateResponseCode 生成密码
-func GenerateResponseCode(secret string, challenge int64, codeLength int) (string, error) {
-	dec := DefaultNewBase32Decode()
-	decode, decodeError := dec.Decode(secret)
-	if decodeError != nil {
-		return "", decodeError
+// checkCodeLength validate the requested code length, 0 is replaced with DefaultCodeLength
+func checkCodeLength(codeLength int) (int, error) {
+	if codeLength == 0 {
+		return DefaultCodeLength, nil
 	}
 
-	challengeBytes := int64ToBytes(challenge)
+	if codeLength < MinCodeLength || codeLength > MaxCodeLength {
+		return 0, fmt.Errorf("unsupported code length: %d, must be between %d and %d", codeLength, MinCodeLength, MaxCodeLength)
+	}
+	return codeLength, nil
+}
 
-	hmacSha1 := hmac.New(sha1.New, decode)
-	hmacSha1.Write(challengeBytes)
-	hash := hmacSha1.Sum(nil)
+// GenerateResponseCode 生成密码
+func GenerateResponseCode(secret string, challenge int64, codeLength int, algorithm Algorithm) (string, error) {
+	codeLength, err := checkCodeLength(codeLength)
+	if err != nil {
+		return "", err
+	}
 
-	offset := int(hash[len(hash)-1] & 0x0F)
-	truncatedHash := hashToInt(hash, offset) & 0x7FFFFFFF
-	pinValue := int(truncatedHash % PinModulo)
-	code := strconv.Itoa(pinValue)
+	truncatedHash, err := generateTruncatedHash(secret, challenge, algorithm)
+	if err != nil {
+		return "", err
+	}
+
+	pinValue := uint64(truncatedHash) % digitsPower[codeLength]
+	code := strconv.FormatUint(pinValue, 10)
 
 	if len(code) >= codeLength {
 		return code, nil
@@ -164,49 +261,80 @@ func GenerateResponseCode(secret string, challenge int64, codeLength int) (strin
 	return strings.Repeat("0", codeLength-len(code)) + code, nil
 }
 
-// NewTotpToken 新生成token
+// generateTruncatedHash hmac of challenge with the dynamic truncation of RFC 4226 section 5.3 applied. The
+// secret is decoded with DecodeLenient, secrets provisioned by earlier versions of NewTotpToken have non-zero
+// trailing bits.
+func generateTruncatedHash(secret string, challenge int64, algorithm Algorithm) (uint32, error) {
+	dec := DefaultNewBase32Decode()
+	decode, decodeError := dec.DecodeLenient(secret)
+	if decodeError != nil {
+		return 0, decodeError
+	}
+
+	challengeBytes := int64ToBytes(challenge)
+
+	mac := hmac.New(algorithm.Hash(), decode)
+	mac.Write(challengeBytes)
+	hash := mac.Sum(nil)
+
+	offset := int(hash[len(hash)-1] & 0x0F)
+	return hashToInt(hash, offset) & 0x7FFFFFFF, nil
+}
+
+// NewTotpToken 新生成token, returns the base32 encoding of length*5/8 random bytes, which is length characters
+// long for every length Decode accepts
+//
+// Deprecated: use GenerateSecret, which takes the secret size in bits and returns the raw secret as well.
 func NewTotpToken(length int) string {
-	defaultBase32Decode := NewBase32Decode(DefaultBase32String)
-	rand.Seed(time.Now().UnixNano())
-	var (
-		num int
-	)
 	if length == 0 {
 		length = 12
 	}
 
-	data := make([]byte, length)
-	for i := 0; i < length; i++ {
-		num = rand.Intn(length - 1)
-		data[i] = byte(defaultBase32Decode.encode[num])
+	data := make([]byte, length*5/8)
+	_, err := rand.Read(data)
+	if err != nil {
+		panic(fmt.Sprintf("unable to read random bytes: %v", err))
 	}
-	return string(data)
+	return DefaultNewBase32Decode().Encode(data)
+}
+
+// NormalizeSecret return the canonical unpadded base32 encoding of secret, decoded with DecodeLenient
+func NormalizeSecret(secret string) (string, error) {
+	dec := DefaultNewBase32Decode()
+	data, err := dec.DecodeLenient(secret)
+	if err != nil {
+		return "", err
+	}
+	return dec.Encode(data), nil
 }
 
 // GetTotpCode 获取totpcode, 这里会生成3个code，当前时间，前30s,后30s 为了预防客户端跟服务端的时间差太大
-func GetTotpCode(secret string, codeLength int) []string {
+func GetTotpCode(secret string, codeLength, period int, algorithm Algorithm) ([]string, error) {
+	return GetTotpCodeAt(secret, time.Now(), codeLength, period, algorithm)
+}
+
+// GetTotpCodeAt return the codes for the step before, at and after time at
+func GetTotpCodeAt(secret string, at time.Time, codeLength, period int, algorithm Algorithm) ([]string, error) {
 	tries := []int64{-1, 0, 1}
-	t := GetChallenge()
+	t := GetChallengeAt(at, period)
 	code := make([]string, len(tries))
 
+	var err error
 	for i := 0; i < len(tries); i++ {
-		code[i], _ = GenerateResponseCode(secret, t+tries[i], codeLength)
+		code[i], err = GenerateResponseCode(secret, t+tries[i], codeLength, algorithm)
+		if err != nil {
+			return nil, err
+		}
 	}
-	return code
+	return code, nil
 }
 
-const defaultCodeLength = 6
-
-// ValidTotpCode 验证totp code
-func ValidTotpCode(totpToken, totpCode string) bool {
-	flag := false
-	code := GetTotpCode(totpToken, defaultCodeLength)
-	for _, c := range code {
-		if totpCode == c {
-			flag = true
-			break
-		}
-	}
+// ValidTotpCode 验证totp code, accepts 6 digit codes for the current 30 second step and one step either side.
+// Use ValidateCustom for other code lengths, periods or windows.
+func ValidTotpCode(totpToken, totpCode string, algorithm Algorithm) bool {
+	opts := DefaultValidateOpts
+	opts.Algorithm = algorithm
 
-	return flag
+	_, ok, err := ValidateCustom(totpToken, totpCode, opts)
+	return err == nil && ok
 }
@@ -0,0 +1,376 @@
+//
+// Copyright © 2020 alexj@backpocket.com
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package totp
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+)
+
+var (
+	// rfcSecretSHA1 key from RFC 4226 appendix D and RFC 6238 appendix B
+	rfcSecretSHA1 = []byte("12345678901234567890")
+	// rfcSecretSHA256 key from the RFC 6238 errata and reference implementation
+	rfcSecretSHA256 = []byte("12345678901234567890123456789012")
+	// rfcSecretSHA512 key from the RFC 6238 errata and reference implementation
+	rfcSecretSHA512 = []byte("1234567890123456789012345678901234567890123456789012345678901234")
+)
+
+func encodeSecret(secret []byte) string {
+	return DefaultNewBase32Decode().Encode(secret)
+}
+
+// TestHotpRFC4226 RFC 4226 appendix D, the truncated decimal values cover every code length from 6 to 10 digits
+func TestHotpRFC4226(t *testing.T) {
+	truncated := []string{
+		"1284755224", "1094287082", "0137359152", "1726969429", "1640338314",
+		"0868254676", "1918287922", "0082162583", "0673399871", "0645520489",
+	}
+
+	secret := encodeSecret(rfcSecretSHA1)
+	for counter, value := range truncated {
+		for digits := MinCodeLength; digits <= MaxCodeLength; digits++ {
+			want := value[len(value)-digits:]
+			got, err := GetHotpCode(secret, uint64(counter), digits, AlgorithmSHA1)
+			if err != nil {
+				t.Fatalf("counter %d digits %d: %v", counter, digits, err)
+			}
+
+			if got != want {
+				t.Errorf("counter %d digits %d: got %s want %s", counter, digits, got, want)
+			}
+		}
+	}
+}
+
+// TestTotpRFC6238 RFC 6238 appendix B, 8 digit codes for each algorithm. The 6 and 7 digit codes are the low
+// digits of the 8 digit code as all of them are reduced from the same truncated value.
+func TestTotpRFC6238(t *testing.T) {
+	secrets := map[Algorithm]string{
+		AlgorithmSHA1:   encodeSecret(rfcSecretSHA1),
+		AlgorithmSHA256: encodeSecret(rfcSecretSHA256),
+		AlgorithmSHA512: encodeSecret(rfcSecretSHA512),
+	}
+
+	vectors := []struct {
+		unix  int64
+		codes map[Algorithm]string
+	}{
+		{59, map[Algorithm]string{AlgorithmSHA1: "94287082", AlgorithmSHA256: "46119246", AlgorithmSHA512: "90693936"}},
+		{1111111109, map[Algorithm]string{AlgorithmSHA1: "07081804", AlgorithmSHA256: "68084774", AlgorithmSHA512: "25091201"}},
+		{1111111111, map[Algorithm]string{AlgorithmSHA1: "14050471", AlgorithmSHA256: "67062674", AlgorithmSHA512: "99943326"}},
+		{1234567890, map[Algorithm]string{AlgorithmSHA1: "89005924", AlgorithmSHA256: "91819424", AlgorithmSHA512: "93441116"}},
+		{2000000000, map[Algorithm]string{AlgorithmSHA1: "69279037", AlgorithmSHA256: "90698825", AlgorithmSHA512: "38618901"}},
+		{20000000000, map[Algorithm]string{AlgorithmSHA1: "65353130", AlgorithmSHA256: "77737706", AlgorithmSHA512: "47863826"}},
+	}
+
+	for _, v := range vectors {
+		at := time.Unix(v.unix, 0)
+		for algorithm, code := range v.codes {
+			for digits := MinCodeLength; digits <= 8; digits++ {
+				want := code[len(code)-digits:]
+				codes, err := GetTotpCodeAt(secrets[algorithm], at, digits, Interval, algorithm)
+				if err != nil {
+					t.Fatalf("%d %v digits %d: %v", v.unix, algorithm, digits, err)
+				}
+
+				if codes[1] != want {
+					t.Errorf("%d %v digits %d: got %s want %s", v.unix, algorithm, digits, codes[1], want)
+				}
+
+				match, ok, err := ValidateCustomAt(secrets[algorithm], want, at, ValidateOpts{Digits: digits, Algorithm: algorithm})
+				if err != nil || !ok || match.Step != v.unix/Interval || match.Drift != 0 {
+					t.Errorf("%d %v digits %d: validate got %+v %v %v", v.unix, algorithm, digits, match, ok, err)
+				}
+			}
+		}
+	}
+}
+
+func TestCodeLength(t *testing.T) {
+	secret := encodeSecret(rfcSecretSHA1)
+	for _, digits := range []int{-1, 1, 5, 11} {
+		_, err := GenerateResponseCode(secret, 0, digits, AlgorithmSHA1)
+		if err == nil {
+			t.Errorf("digits %d: expected error", digits)
+		}
+	}
+
+	code, err := GenerateResponseCode(secret, 0, 0, AlgorithmSHA1)
+	if err != nil || code != "755224" {
+		t.Errorf("digits 0: got %s %v want 755224", code, err)
+	}
+}
+
+func TestSteamCode(t *testing.T) {
+	// truncated values 1284755224 and 1094287082 from RFC 4226 appendix D written in SteamAlphabet
+	secret := encodeSecret(rfcSecretSHA1)
+	for counter, want := range []string{"GG5F5", "PV9M4"} {
+		code, err := GenerateEncodedCode(secret, int64(counter), 0, AlgorithmSHA1, EncodingSteam)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if code != want {
+			t.Errorf("counter %d: got %s want %s", counter, code, want)
+		}
+	}
+
+	at := time.Unix(59, 0)
+	code, err := GenerateSteamCode(secret, GetChallengeAt(at, Interval), AlgorithmSHA1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, ok, err := ValidateCustomAt(secret, code, at, ValidateOpts{Encoding: EncodingSteam})
+	if err != nil || !ok {
+		t.Errorf("validate steam code %s got %v %v", code, ok, err)
+	}
+}
+
+func TestValidateCustomDrift(t *testing.T) {
+	secret := encodeSecret(rfcSecretSHA1)
+	at := time.Unix(1111111111, 0)
+	opts := ValidateOpts{Digits: 8, SkewBehind: 2, SkewAhead: 1}
+
+	for drift := int64(-3); drift <= 2; drift++ {
+		code, err := GenerateResponseCode(secret, GetChallengeAt(at, Interval)+drift, 8, AlgorithmSHA1)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		match, ok, err := ValidateCustomAt(secret, code, at, opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		want := drift >= -2 && drift <= 1
+		if ok != want || (ok && match.Drift != drift) {
+			t.Errorf("drift %d: got %+v %v want %v", drift, match, ok, want)
+		}
+	}
+}
+
+func TestGetChallengeAt(t *testing.T) {
+	cases := []struct {
+		unix   int64
+		period int
+		want   int64
+	}{
+		{0, 30, 0},
+		{29, 30, 0},
+		{30, 30, 1},
+		{59, 0, 1},
+		{1111111109, 30, 37037036},
+		{25, 10, 2},
+		{-1, 30, -1},
+		{-30, 30, -1},
+		{-31, 30, -2},
+	}
+
+	for _, c := range cases {
+		if got := GetChallengeAt(time.Unix(c.unix, 0), c.period); got != c.want {
+			t.Errorf("GetChallengeAt(%d, %d) got %d want %d", c.unix, c.period, got, c.want)
+		}
+	}
+}
+
+func TestInt64ToBytes(t *testing.T) {
+	cases := map[int64][]byte{
+		0:                  {0, 0, 0, 0, 0, 0, 0, 0},
+		1:                  {0, 0, 0, 0, 0, 0, 0, 1},
+		0x0102030405060708: {1, 2, 3, 4, 5, 6, 7, 8},
+		-1:                 {0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff},
+		0x23523ED:          {0, 0, 0, 0, 0x02, 0x35, 0x23, 0xED},
+	}
+
+	for v, want := range cases {
+		if got := int64ToBytes(v); !bytes.Equal(got, want) {
+			t.Errorf("int64ToBytes(%#x) got %x want %x", v, got, want)
+		}
+	}
+}
+
+// TestHashToInt RFC 4226 section 5.4 dynamic truncation example
+func TestHashToInt(t *testing.T) {
+	hash := []byte{
+		0x1f, 0x86, 0x98, 0x69, 0x0e, 0x02, 0xca, 0x16, 0x61, 0x85,
+		0x50, 0xef, 0x7f, 0x19, 0xda, 0x8e, 0x94, 0x5b, 0x55, 0x5a,
+	}
+
+	offset := int(hash[len(hash)-1] & 0x0F)
+	if got := hashToInt(hash, offset); got != 0x50ef7f19 {
+		t.Errorf("hashToInt got %#x want 0x50ef7f19", got)
+	}
+
+	if got := (hashToInt(hash, offset) & 0x7FFFFFFF) % 1000000; got != 872921 {
+		t.Errorf("truncated code got %d want 872921", got)
+	}
+}
+
+// TestBase32RFC4648 RFC 4648 section 10 test vectors
+func TestBase32RFC4648(t *testing.T) {
+	vectors := []struct {
+		decoded string
+		encoded string
+	}{
+		{"", ""},
+		{"f", "MY======"},
+		{"fo", "MZXQ===="},
+		{"foo", "MZXW6==="},
+		{"foob", "MZXW6YQ="},
+		{"fooba", "MZXW6YTB"},
+		{"foobar", "MZXW6YTBOI======"},
+	}
+
+	dec := DefaultNewBase32Decode()
+	for _, v := range vectors {
+		if got := dec.EncodePadded([]byte(v.decoded)); got != v.encoded {
+			t.Errorf("EncodePadded(%q) got %s want %s", v.decoded, got, v.encoded)
+		}
+
+		unpadded := dec.Encode([]byte(v.decoded))
+		for _, encoded := range []string{v.encoded, unpadded, strings.ToLower(v.encoded)} {
+			got, err := dec.Decode(encoded)
+			if err != nil {
+				t.Errorf("Decode(%q): %v", encoded, err)
+				continue
+			}
+
+			if string(got) != v.decoded {
+				t.Errorf("Decode(%q) got %q want %q", encoded, got, v.decoded)
+			}
+		}
+	}
+}
+
+func TestBase32DecodeInvalid(t *testing.T) {
+	dec := DefaultNewBase32Decode()
+	for _, encoded := range []string{"M", "MZX", "MZXW6Y", "MY=", "MY=======", "MZ======", "MZXW6YR=", "M1", "MY==MY==", "MÉ"} {
+		if got, err := dec.Decode(encoded); err == nil {
+			t.Errorf("Decode(%q) got %x expected error", encoded, got)
+		}
+	}
+}
+
+func TestBase32DecodeLenient(t *testing.T) {
+	dec := DefaultNewBase32Decode()
+	// 26 chars is 130 bits, the last char carries 2 leftover bits which are non-zero for B
+	encoded := "JBSWY3DPEHPK3PXPJBSWY3DPEB"
+	if _, err := dec.Decode(encoded); err == nil {
+		t.Errorf("Decode(%q) expected trailing bits error", encoded)
+	}
+
+	got, err := dec.DecodeLenient(encoded)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want, err := dec.Decode("JBSWY3DPEHPK3PXPJBSWY3DPEA")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !bytes.Equal(got, want) {
+		t.Errorf("DecodeLenient(%q) got %x want %x", encoded, got, want)
+	}
+
+	normalized, err := NormalizeSecret(encoded)
+	if err != nil || normalized != "JBSWY3DPEHPK3PXPJBSWY3DPEA" {
+		t.Errorf("NormalizeSecret(%q) got %q, %v", encoded, normalized, err)
+	}
+
+	if _, err := dec.DecodeLenient("M1"); err == nil {
+		t.Errorf("DecodeLenient(%q) expected illegal char error", "M1")
+	}
+}
+
+func TestNewTotpToken(t *testing.T) {
+	dec := DefaultNewBase32Decode()
+	for _, length := range []int{0, 12, 16, 26, 32} {
+		for i := 0; i < 1000; i++ {
+			secret := NewTotpToken(length)
+			if want := length; want != 0 && len(secret) != want {
+				t.Fatalf("NewTotpToken(%d) got %d chars", length, len(secret))
+			}
+
+			if _, err := dec.Decode(secret); err != nil {
+				t.Fatalf("NewTotpToken(%d) got %q which does not decode: %v", length, secret, err)
+			}
+		}
+	}
+}
+
+func TestLegacySecret(t *testing.T) {
+	// 12 characters from earlier versions of NewTotpToken, the last character has non-zero trailing bits
+	secret := "ABCDEFGHIJKB"
+	if _, err := DefaultNewBase32Decode().Decode(secret); err == nil {
+		t.Fatalf("Decode(%q) expected error for non-zero trailing bits", secret)
+	}
+
+	normalized, err := NormalizeSecret(secret)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for step := int64(0); step < 10; step++ {
+		code, err := GenerateResponseCode(secret, step, 6, AlgorithmSHA1)
+		if err != nil {
+			t.Fatalf("GenerateResponseCode(%q) error: %v", secret, err)
+		}
+
+		expected, _ := GenerateResponseCode(normalized, step, 6, AlgorithmSHA1)
+		if code != expected {
+			t.Errorf("GenerateResponseCode(%q, %d) got %s expected %s", secret, step, code, expected)
+		}
+	}
+
+	codes, err := GetTotpCode(secret, 6, Interval, AlgorithmSHA1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !ValidTotpCode(secret, codes[1], AlgorithmSHA1) {
+		t.Errorf("ValidTotpCode(%q, %s) got false", secret, codes[1])
+	}
+
+	if _, err := ParseKey("otpauth://totp/a?secret=" + secret); err != nil {
+		t.Errorf("ParseKey legacy secret error: %v", err)
+	}
+}
+
+func TestGenerateSecret(t *testing.T) {
+	raw, encoded, err := GenerateSecret(0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(raw) != DefaultSecretBits/8 || len(encoded) != 32 {
+		t.Errorf("got %d bytes %d chars want 20 bytes 32 chars", len(raw), len(encoded))
+	}
+
+	decoded, err := DefaultNewBase32Decode().Decode(encoded)
+	if err != nil || !bytes.Equal(decoded, raw) {
+		t.Errorf("encoded secret does not decode to raw secret: %v", err)
+	}
+
+	for _, bits := range []int{64, 129, -8} {
+		if _, _, err := GenerateSecret(bits); err == nil {
+			t.Errorf("GenerateSecret(%d) expected error", bits)
+		}
+	}
+}
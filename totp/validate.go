@@ -0,0 +1,98 @@
+//
+// Copyright © 2020 alexj@backpocket.com
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package totp
+
+import (
+	"crypto/subtle"
+	"time"
+)
+
+// ValidateOpts options used by ValidateCustom
+type ValidateOpts struct {
+	// Digits number of digits in the code, 0 uses DefaultCodeLength
+	Digits int
+	// Period number of seconds each code is valid for, 0 uses Interval
+	Period int
+	// Algorithm hmac algorithm used to generate the code
+	Algorithm Algorithm
+	// Encoding format of the code, Digits is ignored for steam codes
+	Encoding Encoding
+	// SkewBehind number of steps before the current step that are accepted, covers clients with a slow clock
+	SkewBehind uint
+	// SkewAhead number of steps after the current step that are accepted, covers clients with a fast clock
+	SkewAhead uint
+}
+
+// DefaultValidateOpts 6 digit sha1 codes with a 30 second period, accepting one step either side of the current step
+var DefaultValidateOpts = ValidateOpts{
+	Digits:     DefaultCodeLength,
+	Period:     Interval,
+	Algorithm:  AlgorithmSHA1,
+	SkewBehind: 1,
+	SkewAhead:  1,
+}
+
+// Match time step a code was matched against
+type Match struct {
+	// Step time step the code was generated for
+	Step int64
+	// Drift number of steps between Step and the current step, negative when the client clock is behind
+	Drift int64
+}
+
+// ValidateCustom validate code against the current time step and the skew window in opts. The current step is
+// checked first then the window is searched outward, so the match with the smallest drift is returned.
+func ValidateCustom(secret, code string, opts ValidateOpts) (Match, bool, error) {
+	return ValidateCustomAt(secret, code, time.Now(), opts)
+}
+
+// ValidateCustomAt validate code as ValidateCustom does, using the time step of t as the current step
+func ValidateCustomAt(secret, code string, t time.Time, opts ValidateOpts) (Match, bool, error) {
+	digits := opts.Encoding.CodeLength(opts.Digits)
+	if opts.Encoding == EncodingDecimal {
+		if _, err := checkCodeLength(digits); err != nil {
+			return Match{}, false, err
+		}
+	}
+
+	if len(code) != digits {
+		return Match{}, false, nil
+	}
+
+	current := GetChallengeAt(t, opts.Period)
+	for i := int64(0); i <= int64(opts.SkewBehind) || i <= int64(opts.SkewAhead); i++ {
+		drifts := []int64{-i, i}
+		if i == 0 {
+			drifts = drifts[:1]
+		}
+
+		for _, drift := range drifts {
+			if (drift < 0 && -drift > int64(opts.SkewBehind)) || (drift > 0 && drift > int64(opts.SkewAhead)) {
+				continue
+			}
+
+			expected, err := GenerateEncodedCode(secret, current+drift, digits, opts.Algorithm, opts.Encoding)
+			if err != nil {
+				return Match{}, false, err
+			}
+
+			if subtle.ConstantTimeCompare([]byte(expected), []byte(code)) == 1 {
+				return Match{Step: current + drift, Drift: drift}, true, nil
+			}
+		}
+	}
+	return Match{}, false, nil
+}
@@ -0,0 +1,127 @@
+//
+// Copyright © 2020 alexj@backpocket.com
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package totp
+
+import (
+	"errors"
+	"sync"
+	"time"
+)
+
+const (
+	// DefaultMaxFailures number of failed attempts before a subject is locked out
+	DefaultMaxFailures = 5
+	// DefaultLockout duration a subject is locked out for after DefaultMaxFailures failed attempts
+	DefaultLockout = 5 * time.Minute
+)
+
+var (
+	// ErrInvalidCode code did not match any step in the validation window
+	ErrInvalidCode = errors.New("invalid code")
+	// ErrCodeReused code matched a step at or before the last accepted step for the subject
+	ErrCodeReused = errors.New("code already used")
+	// ErrTooManyAttempts subject is locked out after too many failed attempts
+	ErrTooManyAttempts = errors.New("too many failed attempts")
+)
+
+// Validator validate totp codes per subject (e.g. a user name), rejecting codes for a time step at or before the
+// last accepted step and locking out subjects after MaxFailures failed attempts.
+type Validator struct {
+	// Opts options codes are validated with
+	Opts ValidateOpts
+	// Store persists the state of each subject
+	Store Store
+	// MaxFailures failed attempts before the subject is locked out, 0 disables lockout
+	MaxFailures int
+	// Lockout duration a subject is locked out for
+	Lockout time.Duration
+	// Clock source of the current time, nil uses SystemClock
+	Clock Clock
+
+	mu sync.Mutex
+}
+
+// NewValidator create validator using store, a nil store uses a MemoryStore
+func NewValidator(store Store, opts ValidateOpts) *Validator {
+	if store == nil {
+		store = NewMemoryStore()
+	}
+
+	return &Validator{
+		Opts:        opts,
+		Store:       store,
+		MaxFailures: DefaultMaxFailures,
+		Lockout:     DefaultLockout,
+	}
+}
+
+// Validate validate code for subject, returns the matched step or one of ErrInvalidCode, ErrCodeReused,
+// ErrTooManyAttempts or an error from the store.
+func (v *Validator) Validate(subject, secret, code string) (Match, error) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	rec, err := v.Store.Load(subject)
+	if err != nil {
+		return Match{}, err
+	}
+
+	now := v.now()
+	if now.Before(rec.LockedUntil) {
+		return Match{}, ErrTooManyAttempts
+	}
+
+	match, ok, err := ValidateCustomAt(secret, code, now, v.Opts)
+	if err != nil {
+		return Match{}, err
+	}
+
+	switch {
+	case !ok:
+		err = ErrInvalidCode
+	case rec.LastStep != 0 && match.Step <= rec.LastStep:
+		err = ErrCodeReused
+	}
+
+	if err != nil {
+		rec.Failures++
+		if v.MaxFailures > 0 && rec.Failures >= v.MaxFailures {
+			rec.Failures = 0
+			rec.LockedUntil = now.Add(v.Lockout)
+		}
+
+		if saveErr := v.Store.Save(subject, rec); saveErr != nil {
+			return Match{}, saveErr
+		}
+		return Match{}, err
+	}
+
+	rec.LastStep = match.Step
+	rec.Failures = 0
+	rec.LockedUntil = time.Time{}
+	err = v.Store.Save(subject, rec)
+	if err != nil {
+		return Match{}, err
+	}
+	return match, nil
+}
+
+func (v *Validator) now() time.Time {
+	if v.Clock == nil {
+		return time.Now()
+	}
+	return v.Clock.Now()
+}
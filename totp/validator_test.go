@@ -0,0 +1,197 @@
+//
+// Copyright © 2020 alexj@backpocket.com
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package totp
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// validatorStart time of the first attempt in the validator tests, the start of step 1000000
+var validatorStart = time.Unix(1000000*Interval, 0)
+
+// attempt validate code, or the code for step steps from the current step when empty, at validatorStart+at and
+// expect err
+type attempt struct {
+	at   time.Duration
+	step int64
+	code string
+	err  error
+}
+
+func (a attempt) run(t *testing.T, v *Validator, secret string) {
+	t.Helper()
+
+	now := validatorStart.Add(a.at)
+	v.Clock = FixedClock(now)
+
+	code := a.code
+	if code == "" {
+		var err error
+		code, err = GenerateResponseCode(secret, GetChallengeAt(now, Interval)+a.step, DefaultCodeLength, AlgorithmSHA1)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	_, err := v.Validate("alice", secret, code)
+	if err != a.err {
+		t.Errorf("attempt at %v step %+d code %q: got error %v want %v", a.at, a.step, a.code, err, a.err)
+	}
+}
+
+func TestValidator(t *testing.T) {
+	tests := []struct {
+		name     string
+		attempts []attempt
+	}{
+		{"accept current step", []attempt{
+			{at: 0, step: 0},
+		}},
+		{"reject reused step", []attempt{
+			{at: 0, step: 0},
+			{at: 10 * time.Second, step: 0, err: ErrCodeReused},
+		}},
+		{"reject earlier step after later one", []attempt{
+			{at: 0, step: 1},
+			{at: 0, step: 0, err: ErrCodeReused},
+			{at: 0, step: -1, err: ErrCodeReused},
+		}},
+		{"accept next step", []attempt{
+			{at: 0, step: 0},
+			{at: 30 * time.Second, step: 0},
+		}},
+		{"reject code outside window", []attempt{
+			{at: 0, step: 2, err: ErrInvalidCode},
+			{at: 0, step: -2, err: ErrInvalidCode},
+		}},
+		{"lockout after max failures", []attempt{
+			{at: 0, code: "000000", err: ErrInvalidCode},
+			{at: 0, code: "000000", err: ErrInvalidCode},
+			{at: 0, code: "000000", err: ErrInvalidCode},
+			{at: time.Second, step: 0, err: ErrTooManyAttempts},
+			{at: time.Minute, step: 0, err: ErrTooManyAttempts},
+		}},
+		{"reused codes count as failures", []attempt{
+			{at: 0, step: 0},
+			{at: 0, step: 0, err: ErrCodeReused},
+			{at: 0, step: 0, err: ErrCodeReused},
+			{at: 0, step: 0, err: ErrCodeReused},
+			{at: 0, step: 1, err: ErrTooManyAttempts},
+		}},
+		{"lockout expires", []attempt{
+			{at: 0, code: "000000", err: ErrInvalidCode},
+			{at: 0, code: "000000", err: ErrInvalidCode},
+			{at: 0, code: "000000", err: ErrInvalidCode},
+			{at: 2*time.Minute - time.Second, step: 0, err: ErrTooManyAttempts},
+			{at: 2 * time.Minute, step: 0},
+		}},
+		{"success resets failures", []attempt{
+			{at: 0, code: "000000", err: ErrInvalidCode},
+			{at: 0, code: "000000", err: ErrInvalidCode},
+			{at: 0, step: 0},
+			{at: 30 * time.Second, code: "000000", err: ErrInvalidCode},
+			{at: 30 * time.Second, code: "000000", err: ErrInvalidCode},
+			{at: 30 * time.Second, step: 0},
+		}},
+	}
+
+	secret := encodeSecret(rfcSecretSHA1)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			v := NewValidator(nil, DefaultValidateOpts)
+			v.MaxFailures = 3
+			v.Lockout = 2 * time.Minute
+			for _, a := range tt.attempts {
+				a.run(t, v, secret)
+			}
+		})
+	}
+}
+
+func TestValidatorLockoutDisabled(t *testing.T) {
+	secret := encodeSecret(rfcSecretSHA1)
+	v := NewValidator(nil, DefaultValidateOpts)
+	v.MaxFailures = 0
+	for i := 0; i < 2*DefaultMaxFailures; i++ {
+		attempt{at: 0, code: "000000", err: ErrInvalidCode}.run(t, v, secret)
+	}
+	attempt{at: 0, step: 0}.run(t, v, secret)
+}
+
+func TestValidatorSubjects(t *testing.T) {
+	secret := encodeSecret(rfcSecretSHA1)
+	v := NewValidator(nil, DefaultValidateOpts)
+	v.Clock = FixedClock(validatorStart)
+
+	code, err := GenerateResponseCode(secret, GetChallengeAt(validatorStart, Interval), DefaultCodeLength, AlgorithmSHA1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, subject := range []string{"alice", "bob"} {
+		if _, err := v.Validate(subject, secret, code); err != nil {
+			t.Errorf("subject %s: %v", subject, err)
+		}
+	}
+
+	if _, err := v.Validate("alice", secret, code); err != ErrCodeReused {
+		t.Errorf("subject alice: got error %v want %v", err, ErrCodeReused)
+	}
+}
+
+func TestFileStore(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "validator.json")
+	secret := encodeSecret(rfcSecretSHA1)
+
+	newValidator := func() *Validator {
+		v := NewValidator(NewFileStore(path), DefaultValidateOpts)
+		v.MaxFailures = 2
+		v.Lockout = time.Minute
+		return v
+	}
+
+	// state written by one validator is seen by a new validator reading the same file
+	attempt{at: 0, step: 0}.run(t, newValidator(), secret)
+	attempt{at: 0, step: 0, err: ErrCodeReused}.run(t, newValidator(), secret)
+	attempt{at: 0, code: "000000", err: ErrInvalidCode}.run(t, newValidator(), secret)
+	attempt{at: time.Second, step: 0, err: ErrTooManyAttempts}.run(t, newValidator(), secret)
+	attempt{at: time.Minute, step: 0}.run(t, newValidator(), secret)
+
+	rec, err := NewFileStore(path).Load("alice")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := Record{LastStep: GetChallengeAt(validatorStart.Add(time.Minute), Interval)}
+	if rec.LastStep != want.LastStep || rec.Failures != 0 || !rec.LockedUntil.IsZero() {
+		t.Errorf("got record %+v want %+v", rec, want)
+	}
+
+	rec, err = NewFileStore(path).Load("bob")
+	if err != nil || rec != (Record{}) {
+		t.Errorf("unknown subject got record %+v, %v want zero record", rec, err)
+	}
+}
+
+func TestFileStoreMissingFile(t *testing.T) {
+	s := NewFileStore(filepath.Join(t.TempDir(), "missing.json"))
+	rec, err := s.Load("alice")
+	if err != nil || rec != (Record{}) {
+		t.Errorf("got record %+v, %v want zero record", rec, err)
+	}
+}